@@ -1,6 +1,7 @@
 package gosio
 
 import (
+	"net/http"
 	"sync"
 
 	"github.com/gnabgib/go-sio/protocol"
@@ -13,18 +14,62 @@ import (
 // - use In and Out channels for message exchange
 // - Close message means channel is closed
 // - ping/pong replies are automatic
+// - every namespace has its own Channel, sharing the session of the connection
 type Channel struct {
-	conn transport.Connection
+	*session
 
-	in     chan *protocol.Message
-	out    chan string
-	header Header
+	namespace string
+	sid       string
+
+	//client or socket the channel is bound to, nil when detached
+	owner *binding
+	//handlers of the namespace
+	events *event
+	//namespace left while the session stays open
+	left DisconnectReason
+}
+
+/**
+Engine.IO connection shared by all the namespaces multiplexed on it
+*/
+type session struct {
+	conn     transport.Connection
+	connLock sync.RWMutex
+
+	in      chan *protocol.Message
+	out     chan string
+	outLock sync.Mutex
+	header  Header
 
 	alive     bool
 	aliveLock sync.Mutex
 
 	ack ackProcessor
 	sequentialInLoop bool
+	//handlers run on a worker pool when set
+	dispatcher *dispatcher
+
+	version   ProtocolVersion
+	auth      interface{}
+	heartbeat chan struct{}
+	opened    bool
+
+	//accepting server if any, request is the one that opened the session
+	server  *Server
+	request *http.Request
+	//claims of the token the client was admitted with, see JWTVerifier
+	claims Claims
+
+	//closed once the session is over, closeReason and closeErr tell why
+	closed      chan struct{}
+	closeReason DisconnectReason
+	closeErr    error
+
+	//why the session closes once the out queue is written, see closeAfterWrite
+	pendingReason DisconnectReason
+	pendingErr    error
+	//a server runs its middlewares on the client
+	admitting bool
 }
 
 /**
@@ -32,14 +77,37 @@ create channel, map, and set active
 */
 func (c *Channel) initChannel() {
 	//TODO: queueBufferSize from constant to server or client variable
+	c.session = &session{}
 	c.in = make(chan *protocol.Message, queueBufferSize)
 	c.out = make(chan string, queueBufferSize)
-	c.ack.resultWaiters = make(map[int](chan string))
+	c.ack.resultWaiters = make(map[int]*AckFuture)
+	c.heartbeat = make(chan struct{}, 1)
+	c.closed = make(chan struct{})
+	c.sid = ""
 	c.alive = true
 }
 
+/**
+Current transport connection, swapped when the transport is upgraded
+*/
+func (c *Channel) connection() transport.Connection {
+	c.connLock.RLock()
+	defer c.connLock.RUnlock()
+
+	return c.conn
+}
+
+// Namespace - of the channel, empty for the root namespace
+func (c *Channel) Namespace() string {
+	return c.namespace
+}
+
 // ID - Of current connection (provided by server, unique)
+// - with EIO4 this is the socket id from the namespace CONNECT reply
 func (c *Channel) ID() string {
+	if c.sid != "" {
+		return c.sid
+	}
 	return c.header.Sid
 }
 
@@ -50,3 +118,47 @@ func (c *Channel) IsAlive() bool {
 
 	return c.alive
 }
+
+// DisconnectReason - why the channel was closed, empty while it is alive
+func (c *Channel) DisconnectReason() DisconnectReason {
+	c.aliveLock.Lock()
+	defer c.aliveLock.Unlock()
+
+	if c.left != "" {
+		return c.left
+	}
+	return c.closeReason
+}
+
+/**
+Why the session closed, nil while it is alive
+*/
+func (c *Channel) disconnectError() error {
+	c.aliveLock.Lock()
+	defer c.aliveLock.Unlock()
+
+	if c.alive {
+		return nil
+	}
+	return &DisconnectError{Reason: c.closeReason, Err: c.closeErr}
+}
+
+/**
+Mark the session as open once the Engine.IO handshake is received,
+namespaces can only be joined from then on
+*/
+func (c *Channel) setOpened() {
+	c.aliveLock.Lock()
+	c.opened = true
+	c.aliveLock.Unlock()
+}
+
+/**
+Whether the Engine.IO handshake has been received on a live session
+*/
+func (c *Channel) isOpened() bool {
+	c.aliveLock.Lock()
+	defer c.aliveLock.Unlock()
+
+	return c.alive && c.opened
+}
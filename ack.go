@@ -1,6 +1,7 @@
 package gosio
 
 import (
+	"context"
 	"errors"
 	"sync"
 )
@@ -16,10 +17,25 @@ type ackProcessor struct {
 	counter     int
 	counterLock sync.Mutex
 
-	resultWaiters     map[int](chan string)
+	resultWaiters     map[int]*AckFuture
 	resultWaitersLock sync.RWMutex
 }
 
+// AckFuture - Pending response of an ack request
+// - Done is closed once the response arrived or the request failed
+// - Wait returns the raw response, WaitInto decodes it like AckInto
+// - Cancel stops waiting, the response is ignored if it arrives later
+type AckFuture struct {
+	id     int
+	method string
+	ack    *ackProcessor
+
+	done   chan struct{}
+	once   sync.Once
+	result string
+	err    error
+}
+
 // nextID - Next ID of ack call
 func (a *ackProcessor) nextID() int {
 	a.counterLock.Lock()
@@ -33,7 +49,7 @@ func (a *ackProcessor) nextID() int {
 Just before the ack function called, the waiter should be added
 to wait and receive response to ack call
 */
-func (a *ackProcessor) addWaiter(id int, w chan string) {
+func (a *ackProcessor) addWaiter(id int, w *AckFuture) {
 	a.resultWaitersLock.Lock()
 	a.resultWaiters[id] = w
 	a.resultWaitersLock.Unlock()
@@ -51,7 +67,7 @@ func (a *ackProcessor) removeWaiter(id int) {
 /**
 check if waiter with given ack id is exists, and returns it
 */
-func (a *ackProcessor) getWaiter(id int) (chan string, error) {
+func (a *ackProcessor) getWaiter(id int) (*AckFuture, error) {
 	a.resultWaitersLock.RLock()
 	defer a.resultWaitersLock.RUnlock()
 
@@ -60,3 +76,78 @@ func (a *ackProcessor) getWaiter(id int) (chan string, error) {
 	}
 	return nil, errorWaiterNotFound
 }
+
+/**
+Complete every pending waiter with err, the connection is gone
+*/
+func (a *ackProcessor) failAll(err error) {
+	a.resultWaitersLock.Lock()
+	waiters := a.resultWaiters
+	a.resultWaiters = make(map[int]*AckFuture)
+	a.resultWaitersLock.Unlock()
+
+	for _, waiter := range waiters {
+		waiter.complete("", err)
+	}
+}
+
+/**
+Register the waiter of a new ack request
+*/
+func (a *ackProcessor) newFuture(method string) *AckFuture {
+	f := &AckFuture{
+		id:     a.nextID(),
+		method: method,
+		ack:    a,
+		done:   make(chan struct{}),
+	}
+	a.addWaiter(f.id, f)
+	return f
+}
+
+/**
+Future completed with an error, without any request sent
+*/
+func failedAck(method string, err error) *AckFuture {
+	f := &AckFuture{method: method, done: make(chan struct{})}
+	f.complete("", err)
+	return f
+}
+
+/**
+Set the outcome once, the waiter is unregistered
+*/
+func (f *AckFuture) complete(result string, err error) {
+	f.once.Do(func() {
+		if f.ack != nil {
+			f.ack.removeWaiter(f.id)
+		}
+		f.result, f.err = result, err
+		close(f.done)
+	})
+}
+
+// Done - closed once the outcome is known
+func (f *AckFuture) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait - Block until the response arrives, returns the raw response
+func (f *AckFuture) Wait() (string, error) {
+	<-f.done
+	return f.result, f.err
+}
+
+// WaitInto - Block until the response arrives, its values are decoded into out
+func (f *AckFuture) WaitInto(out ...interface{}) error {
+	result, err := f.Wait()
+	if err != nil {
+		return err
+	}
+	return decodeAck(f.method, result, out)
+}
+
+// Cancel - stop waiting for the response, Wait returns context.Canceled
+func (f *AckFuture) Cancel() {
+	f.complete("", context.Canceled)
+}
@@ -0,0 +1,166 @@
+package gosio
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gnabgib/go-sio/protocol"
+	"github.com/gnabgib/go-sio/transport"
+	"github.com/gorilla/websocket"
+)
+
+const testHandshake = `0{"sid":"eng","upgrades":[],"pingInterval":20000,"pingTimeout":2000}`
+
+func TestAckWhileClosing(t *testing.T) {
+	srv, u := fakeServer(t, func(ws *websocket.Conn, r *http.Request) {
+		writePacket(ws, testHandshake)
+		writePacket(ws, "40")
+		time.Sleep(20 * time.Millisecond)
+		writePacket(ws, "41")
+		readPacket(ws, time.Second)
+	})
+	defer srv.Close()
+
+	c := New(u, transport.GetDefaultWebsocketTransport())
+	channels := make(chan *Channel, 1)
+	c.OnConnect(func(ch *Channel) { channels <- ch })
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ch := <-channels
+
+	//acks requested while the session closes fail with the reason it closed for
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				_, err := ch.AckAsync(context.Background(), "ping", nil).Wait()
+				var disconnected *DisconnectError
+				if !errors.As(err, &disconnected) {
+					continue
+				}
+				if disconnected.Reason != ReasonServerDisconnect {
+					t.Errorf("reason %q", disconnected.Reason)
+				}
+				return
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// answerAcks answers the ack requests of a fake server session with answers,
+// by method, requests of other methods are left unanswered
+func answerAcks(ws *websocket.Conn, answers map[string]string) {
+	for p := readPacket(ws, time.Second); p != ""; p = readPacket(ws, time.Second) {
+		m, err := protocol.Decode(p)
+		if err != nil || m.Type != protocol.MessageTypeAckRequest {
+			continue
+		}
+		if answer, ok := answers[m.Method]; ok {
+			writePacket(ws, protocol.MustEncode(&protocol.Message{Type: protocol.MessageTypeAckResponse, AckID: m.AckID, Args: answer}))
+		}
+	}
+}
+
+func TestAckFuture(t *testing.T) {
+	srv, u := fakeServer(t, func(ws *websocket.Conn, r *http.Request) {
+		writePacket(ws, testHandshake)
+		writePacket(ws, "40")
+		answerAcks(ws, map[string]string{"answered": "7", "callback": `"cb"`})
+	})
+	defer srv.Close()
+
+	c := New(u, transport.GetDefaultWebsocketTransport())
+	channels := make(chan *Channel, 1)
+	c.OnConnect(func(ch *Channel) { channels <- ch })
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ch := <-channels
+
+	cancelled := c.AckAsync(context.Background(), "silent", nil)
+	answered := c.AckAsync(context.Background(), "answered", nil)
+	callback := make(chan string, 1)
+	c.EmitWithAck("callback", nil, func(result string, err error) { callback <- result })
+
+	cancelled.Cancel()
+	select {
+	case <-cancelled.Done():
+	default:
+		t.Fatal("Done not closed by Cancel")
+	}
+	if _, err := cancelled.Wait(); err != context.Canceled {
+		t.Fatalf("cancelled ack: %v", err)
+	}
+	var n int
+	if err := answered.WaitInto(&n); err != nil || n != 7 {
+		t.Fatalf("WaitInto %d %v", n, err)
+	}
+	select {
+	case result := <-callback:
+		if result != `"cb"` {
+			t.Fatalf("callback got %q", result)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("callback not called")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	expired := c.AckAsync(ctx, "silent", nil)
+	select {
+	case <-expired.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Done not closed once ctx expired")
+	}
+	if _, err := expired.Wait(); err != context.DeadlineExceeded {
+		t.Fatalf("expired ack: %v", err)
+	}
+
+	//cancelled and expired requests no longer wait for their response
+	ch.ack.resultWaitersLock.RLock()
+	left := len(ch.ack.resultWaiters)
+	ch.ack.resultWaitersLock.RUnlock()
+	if left != 0 {
+		t.Fatalf("%d waiters left", left)
+	}
+}
+
+func TestAckFuncAnswersOnce(t *testing.T) {
+	s, hs, endpoint := testServer(t)
+	defer hs.Close()
+	defer s.Close()
+	s.On("double", func(c *Channel, n int, ack AckFunc) {
+		//answered later, from several goroutines at once
+		go func() {
+			var wg sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					ack(n * 2)
+				}()
+			}
+			wg.Wait()
+			c.Emit("marker")
+		}()
+	})
+
+	ws, _ := connectRaw(t, endpoint)
+	defer ws.Close()
+	writePacket(ws, `421["double",21]`)
+	for _, want := range []string{`431[42]`, `42["marker"]`} {
+		if p := readSkippingPings(ws, time.Second); p != want {
+			t.Fatalf("got %q, want %q", p, want)
+		}
+	}
+}
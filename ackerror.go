@@ -0,0 +1,135 @@
+package gosio
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// AckErrorFormat - Convention carrying the error of a handler in an ack response
+// - EncodeAck gives the response for the values returned by a handler and its error
+// - DecodeAck gives the error carried by a response (nil if none) and its other values
+type AckErrorFormat interface {
+	EncodeAck(values []interface{}, err error) []interface{}
+	DecodeAck(values []json.RawMessage) ([]json.RawMessage, error)
+}
+
+var (
+	// AckErrorObject - an error is answered as [{"error": "message"}], values as
+	// they are, the default
+	AckErrorObject AckErrorFormat = errorObject{}
+	// AckErrorFirst - node style, an error is answered as ["message", null],
+	// values follow a null error: [null, values...]
+	AckErrorFirst AckErrorFormat = errorFirst{}
+)
+
+// AckError - error found in an ack response, see AckResult
+type AckError struct {
+	Method  string
+	Message string
+}
+
+func (e *AckError) Error() string {
+	if e.Method == "" {
+		return e.Message
+	}
+	return "Ack " + e.Method + ": " + e.Message
+}
+
+type errorObject struct{}
+
+func (errorObject) EncodeAck(values []interface{}, err error) []interface{} {
+	if err != nil {
+		return []interface{}{map[string]string{"error": err.Error()}}
+	}
+	return values
+}
+
+func (errorObject) DecodeAck(values []json.RawMessage) ([]json.RawMessage, error) {
+	if len(values) == 0 {
+		return values, nil
+	}
+
+	//an object holding nothing but the error
+	var object map[string]json.RawMessage
+	if json.Unmarshal(values[0], &object) != nil || len(object) != 1 {
+		return values, nil
+	}
+	if message, ok := object["error"]; ok {
+		return nil, &AckError{Message: errorMessage(message)}
+	}
+	return values, nil
+}
+
+type errorFirst struct{}
+
+func (errorFirst) EncodeAck(values []interface{}, err error) []interface{} {
+	if err != nil {
+		return []interface{}{err.Error(), nil}
+	}
+	return append([]interface{}{nil}, values...)
+}
+
+func (errorFirst) DecodeAck(values []json.RawMessage) ([]json.RawMessage, error) {
+	if len(values) == 0 {
+		return values, nil
+	}
+	if string(values[0]) != "null" {
+		return nil, &AckError{Message: errorMessage(values[0])}
+	}
+	return values[1:], nil
+}
+
+/**
+Text of an error value, a string, an object with a message or any JSON
+*/
+func errorMessage(value json.RawMessage) string {
+	var message string
+	if json.Unmarshal(value, &message) == nil {
+		return message
+	}
+
+	var object struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(value, &object) == nil && object.Message != "" {
+		return object.Message
+	}
+	return string(value)
+}
+
+/**
+Error convention of the handlers and ack responses of e
+*/
+func (e *event) ackErrorFormat() AckErrorFormat {
+	if e.ackErrors != nil {
+		if format := e.ackErrors(); format != nil {
+			return format
+		}
+	}
+	return AckErrorObject
+}
+
+/**
+Decode an ack response with the error convention of the channel, the error
+is returned as *AckError
+*/
+func (c *Channel) decodeAckResult(method, result string, out []interface{}) error {
+	values, err := ackValues(method, result)
+	if err != nil {
+		return err
+	}
+
+	format := AckErrorObject
+	if c.events != nil {
+		format = c.events.ackErrorFormat()
+	}
+	values, err = format.DecodeAck(values)
+	var ackErr *AckError
+	if errors.As(err, &ackErr) && ackErr.Method == "" {
+		ackErr.Method = method
+	}
+	if err != nil {
+		return err
+	}
+	return bindAck(method, values, out)
+}
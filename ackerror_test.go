@@ -0,0 +1,109 @@
+package gosio
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gnabgib/go-sio/transport"
+	"github.com/gorilla/websocket"
+)
+
+func TestAckErrorEncoding(t *testing.T) {
+	tests := []struct {
+		format AckErrorFormat
+		half   string
+		odd    string
+		check  string
+	}{
+		{AckErrorObject, `431[21]`, `432[{"error":"odd"}]`, `433[]`},
+		{AckErrorFirst, `431[null,21]`, `432["odd",null]`, `433[null]`},
+	}
+	for _, test := range tests {
+		s, hs, endpoint := testServer(t)
+		s.AckErrors = test.format
+		s.On("half", func(c *Channel, n int) (int, error) {
+			if n%2 != 0 {
+				return 0, errors.New("odd")
+			}
+			return n / 2, nil
+		})
+		s.On("check", func(c *Channel) error { return nil })
+
+		ws, _ := connectRaw(t, endpoint)
+		writePacket(ws, `421["half",42]`)
+		writePacket(ws, `422["half",7]`)
+		writePacket(ws, `423["check"]`)
+		//handlers run concurrently, the responses come in any order
+		got := make(map[string]bool)
+		for i := 0; i < 3; i++ {
+			got[readSkippingPings(ws, time.Second)] = true
+		}
+		for _, want := range []string{test.half, test.odd, test.check} {
+			if !got[want] {
+				t.Errorf("%T: %q not answered, got %v", test.format, want, got)
+			}
+		}
+		ws.Close()
+		hs.Close()
+		s.Close()
+	}
+}
+
+func TestAckResult(t *testing.T) {
+	tests := []struct {
+		format  AckErrorFormat
+		answers map[string]string
+	}{
+		{AckErrorObject, map[string]string{
+			"value": `21,"extra"`,
+			"error": `{"error":"odd"}`,
+			"cause": `{"error":{"message":"odd"}}`,
+		}},
+		{AckErrorFirst, map[string]string{
+			"value": `null,21,"extra"`,
+			"error": `"odd",null`,
+			"cause": `{"message":"odd"}`,
+		}},
+	}
+	for _, test := range tests {
+		answers := test.answers
+		srv, u := fakeServer(t, func(ws *websocket.Conn, r *http.Request) {
+			writePacket(ws, testHandshake)
+			writePacket(ws, "40")
+			answerAcks(ws, answers)
+		})
+
+		c := New(u, transport.GetDefaultWebsocketTransport())
+		c.AckErrors = test.format
+		connected := make(chan bool, 1)
+		c.OnConnect(func(ch *Channel) { connected <- true })
+		if err := c.Dial(); err != nil {
+			t.Fatal(err)
+		}
+		<-connected
+
+		ctx := context.Background()
+		var n int
+		if err := c.AckResult(ctx, "value", nil, &n); err != nil || n != 21 {
+			t.Errorf("%T: value %d %v", test.format, n, err)
+		}
+		for _, method := range []string{"error", "cause"} {
+			err := c.AckResult(ctx, method, nil, &n)
+			var ackErr *AckError
+			if !errors.As(err, &ackErr) || ackErr.Message != "odd" || ackErr.Method != method {
+				t.Errorf("%T: %s answered %v", test.format, method, err)
+			}
+		}
+		//AckInto does not look for errors
+		var raw interface{}
+		if err := c.AckInto(ctx, "error", nil, &raw); err != nil || raw == nil {
+			t.Errorf("%T: AckInto %v %v", test.format, raw, err)
+		}
+
+		c.Close()
+		srv.Close()
+	}
+}
@@ -0,0 +1,148 @@
+package gosio
+
+import (
+	"encoding/json"
+)
+
+// Adapter - room registry and broadcaster of a server, it links several
+// nodes (servers) when it spreads broadcasts among them
+// - Init is called once by the server, node reaches the local clients
+// - AddAll, Del, DelAll and Rooms keep the rooms of the local clients
+// - Broadcast and FetchSockets apply to the clients of every node, unless opts.Local
+// - ServerSideEmit calls the OnServerSideEmit handlers of the other nodes
+type Adapter interface {
+	Init(node Node) error
+	AddAll(id string, rooms []string)
+	Del(id, room string)
+	DelAll(id string)
+	Rooms(id string) []string
+	Broadcast(opts BroadcastOptions, method string, args []interface{}) error
+	FetchSockets(opts BroadcastOptions) ([]SocketInfo, error)
+	ServerSideEmit(method string, args []interface{}) error
+	Close() error
+}
+
+// Node - the server an adapter works for
+// - ID is unique among the linked nodes
+// - Deliver emits an event to the local clients with the given IDs
+// - ServerSide calls the OnServerSideEmit handlers, args is a JSON array
+type Node interface {
+	ID() string
+	Deliver(ids []string, method string, args []interface{}) error
+	ServerSide(method string, args json.RawMessage)
+}
+
+// BroadcastOptions - clients a broadcast reaches
+type BroadcastOptions struct {
+	// Rooms - clients in any of them, every client when empty
+	Rooms []string `json:"rooms,omitempty"`
+	// Except - clients in none of them
+	Except []string `json:"except,omitempty"`
+	// Local - only the clients of this node
+	Local bool `json:"local,omitempty"`
+}
+
+// SocketInfo - a client found by FetchSockets, of this node or another one.
+// Reach it with To(ID)
+type SocketInfo struct {
+	ID    string   `json:"id"`
+	Rooms []string `json:"rooms"`
+	Node  string   `json:"node"`
+}
+
+// MemoryAdapter - rooms of a single node, the default adapter
+type MemoryAdapter struct {
+	rooms *roomSet
+	node  Node
+}
+
+// NewMemoryAdapter - adapter keeping the rooms in memory, without other nodes
+func NewMemoryAdapter() *MemoryAdapter {
+	return &MemoryAdapter{rooms: newRoomSet()}
+}
+
+// Init - serve the given node
+func (a *MemoryAdapter) Init(node Node) error {
+	a.node = node
+	return nil
+}
+
+// AddAll - the client joins the rooms
+func (a *MemoryAdapter) AddAll(id string, rooms []string) {
+	a.rooms.join(id, rooms...)
+}
+
+// Del - the client leaves the room
+func (a *MemoryAdapter) Del(id, room string) {
+	a.rooms.leave(id, room)
+}
+
+// DelAll - the client leaves every room
+func (a *MemoryAdapter) DelAll(id string) {
+	a.rooms.leaveAll(id)
+}
+
+// Rooms - rooms of the client, sorted
+func (a *MemoryAdapter) Rooms(id string) []string {
+	return a.rooms.rooms(id)
+}
+
+// Broadcast - emit to the matching clients
+func (a *MemoryAdapter) Broadcast(opts BroadcastOptions, method string, args []interface{}) error {
+	return a.node.Deliver(a.rooms.match(opts.Rooms, opts.Except), method, args)
+}
+
+// FetchSockets - the matching clients
+func (a *MemoryAdapter) FetchSockets(opts BroadcastOptions) ([]SocketInfo, error) {
+	ids := a.rooms.match(opts.Rooms, opts.Except)
+	sockets := make([]SocketInfo, 0, len(ids))
+	for _, id := range ids {
+		sockets = append(sockets, SocketInfo{ID: id, Rooms: a.rooms.rooms(id), Node: a.node.ID()})
+	}
+	return sockets, nil
+}
+
+// ServerSideEmit - no-op, there is no other node
+func (a *MemoryAdapter) ServerSideEmit(method string, args []interface{}) error {
+	return nil
+}
+
+// Close - no-op
+func (a *MemoryAdapter) Close() error {
+	return nil
+}
+
+/**
+Node of a server, given to its adapter
+*/
+type node struct {
+	server *Server
+}
+
+func (n *node) ID() string {
+	return n.server.id
+}
+
+func (n *node) Deliver(ids []string, method string, args []interface{}) error {
+	var first error
+	for _, id := range ids {
+		c := n.server.Channel(id)
+		if c == nil {
+			continue
+		}
+		if err := c.Emit(method, args...); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (n *node) ServerSide(method string, args json.RawMessage) {
+	n.server.serverSideLock.RLock()
+	handlers := n.server.serverSide
+	n.server.serverSideLock.RUnlock()
+
+	for _, f := range handlers {
+		f(method, args)
+	}
+}
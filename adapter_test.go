@@ -0,0 +1,118 @@
+package gosio
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+)
+
+/**
+Node recording what its adapter delivers
+*/
+type recordingNode struct {
+	id         string
+	deliveries chan delivery
+	serverSide chan string
+}
+
+type delivery struct {
+	ids    []string
+	method string
+	args   string
+}
+
+func newRecordingNode(id string) *recordingNode {
+	return &recordingNode{id: id, deliveries: make(chan delivery, 16), serverSide: make(chan string, 16)}
+}
+
+func (n *recordingNode) ID() string {
+	return n.id
+}
+
+func (n *recordingNode) Deliver(ids []string, method string, args []interface{}) error {
+	data, _ := json.Marshal(args)
+	ids = append([]string(nil), ids...)
+	sort.Strings(ids)
+	n.deliveries <- delivery{ids: ids, method: method, args: string(data)}
+	return nil
+}
+
+func (n *recordingNode) ServerSide(method string, args json.RawMessage) {
+	n.serverSide <- method + string(args)
+}
+
+func TestMemoryAdapterRooms(t *testing.T) {
+	a := NewMemoryAdapter()
+	n := newRecordingNode("n1")
+	a.Init(n)
+
+	a.AddAll("a", []string{"a", "red", "blue"})
+	a.AddAll("b", []string{"b", "red"})
+	a.AddAll("c", []string{"c", "blue"})
+	if rooms := a.Rooms("a"); !reflect.DeepEqual(rooms, []string{"a", "blue", "red"}) {
+		t.Fatalf("rooms of a %v", rooms)
+	}
+
+	tests := []struct {
+		opts BroadcastOptions
+		ids  []string
+	}{
+		{BroadcastOptions{}, []string{"a", "b", "c"}},
+		{BroadcastOptions{Rooms: []string{"red"}}, []string{"a", "b"}},
+		{BroadcastOptions{Rooms: []string{"red", "blue"}}, []string{"a", "b", "c"}},
+		{BroadcastOptions{Rooms: []string{"red"}, Except: []string{"a"}}, []string{"b"}},
+		{BroadcastOptions{Except: []string{"blue"}}, []string{"b"}},
+		{BroadcastOptions{Rooms: []string{"green"}}, nil},
+	}
+	for _, test := range tests {
+		if err := a.Broadcast(test.opts, "news", []interface{}{1, "x"}); err != nil {
+			t.Fatal(err)
+		}
+		d := <-n.deliveries
+		if !reflect.DeepEqual(d.ids, test.ids) || d.method != "news" || d.args != `[1,"x"]` {
+			t.Errorf("broadcast %+v delivered %+v, want %v", test.opts, d, test.ids)
+		}
+	}
+
+	a.Del("a", "red")
+	a.DelAll("c")
+	if rooms := a.Rooms("c"); len(rooms) != 0 {
+		t.Fatalf("rooms of c after DelAll %v", rooms)
+	}
+	sockets, _ := a.FetchSockets(BroadcastOptions{Rooms: []string{"red", "blue"}})
+	if len(sockets) != 2 {
+		t.Fatalf("sockets %+v", sockets)
+	}
+	sort.Slice(sockets, func(i, j int) bool { return sockets[i].ID < sockets[j].ID })
+	want := []SocketInfo{
+		{ID: "a", Rooms: []string{"a", "blue"}, Node: "n1"},
+		{ID: "b", Rooms: []string{"b", "red"}, Node: "n1"},
+	}
+	if !reflect.DeepEqual(sockets, want) {
+		t.Fatalf("sockets %+v", sockets)
+	}
+}
+
+func TestMemoryAdapterConcurrentRooms(t *testing.T) {
+	a := NewMemoryAdapter()
+	a.Init(newRecordingNode("n1"))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				a.AddAll(id, []string{"room"})
+				a.Rooms(id)
+				a.DelAll(id)
+			}
+		}(string(rune('a' + i)))
+	}
+	wg.Wait()
+	if sockets, _ := a.FetchSockets(BroadcastOptions{}); len(sockets) != 0 {
+		t.Fatalf("sockets left %+v", sockets)
+	}
+}
@@ -0,0 +1,354 @@
+package gosio
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gnabgib/go-sio/protocol"
+	"github.com/golang/glog"
+)
+
+var (
+	errorNotConnected = errors.New("Not connected")
+
+	// ErrOfflineBufferFull - returned by Emit when the offline buffer is full
+	// and the policy is OfflineError
+	ErrOfflineBufferFull = errors.New("Offline buffer full")
+)
+
+// OfflinePolicy - what Emit does when the offline buffer is full
+type OfflinePolicy int
+
+const (
+	// OfflineDropOldest - discard the oldest buffered message
+	OfflineDropOldest OfflinePolicy = iota
+	// OfflineDropNewest - discard the message being emitted
+	OfflineDropNewest
+	// OfflineError - discard the message being emitted, Emit returns ErrOfflineBufferFull
+	OfflineError
+)
+
+/**
+Emit waiting in the offline buffer, or ack request when ack is set
+*/
+type offlineEmit struct {
+	method string
+	args   interface{}
+	ack    *AckFuture
+}
+
+/**
+Handle on the channel of the current connection, a new channel is bound on
+every dial so goroutines of a lost connection never see the next one
+*/
+type binding struct {
+	namespace string
+
+	channel     *Channel
+	channelLock sync.RWMutex
+
+	//connected channel emits go to, offline ones are buffered until the next
+	//one connects
+	ready       *Channel
+	offline     []offlineEmit
+	offlineLock sync.Mutex
+	settings    func() (int, OfflinePolicy)
+
+	//called once a channel is connected, after the offline buffer is sent
+	onConnected func()
+}
+
+/**
+Channel of the current connection, nil before the first dial
+*/
+func (b *binding) current() *Channel {
+	b.channelLock.RLock()
+	defer b.channelLock.RUnlock()
+
+	return b.channel
+}
+
+func (b *binding) bind(c *Channel) {
+	c.owner = b
+
+	b.channelLock.Lock()
+	b.channel = c
+	b.channelLock.Unlock()
+}
+
+/**
+Channel bound to the given session, nil once another session is bound
+*/
+func (b *binding) channelOf(sess *session) *Channel {
+	c := b.current()
+	if c == nil || c.session != sess {
+		return nil
+	}
+	return c
+}
+
+// Namespace - handled by the client or socket, empty for the root namespace
+func (b *binding) Namespace() string {
+	return b.namespace
+}
+
+// ID - Of current connection (provided by server, unique), empty when not connected
+func (b *binding) ID() string {
+	if c := b.current(); c != nil {
+		return c.ID()
+	}
+	return ""
+}
+
+// IsAlive - whether the current connection is still alive
+func (b *binding) IsAlive() bool {
+	c := b.current()
+	return c != nil && c.IsAlive()
+}
+
+// DisconnectReason - why the current connection was closed, empty while it is alive
+func (b *binding) DisconnectReason() DisconnectReason {
+	if c := b.current(); c != nil {
+		return c.DisconnectReason()
+	}
+	return ""
+}
+
+// Emit - Send a message over the current connection (do not expect a response),
+// every arg is a separate argument of the event
+// - while disconnected or connecting the message is buffered and sent once connected
+func (b *binding) Emit(method string, args ...interface{}) error {
+	msg := &protocol.Message{Type: protocol.MessageTypeEmit, Method: method}
+	c, err := b.sendOrBuffer(msg, args)
+	if c != nil {
+		//outgoing listeners may emit too, the offline lock is released
+		notifyOutgoing(c, msg)
+	}
+	return err
+}
+
+/**
+Send msg over the connected channel, returned when msg was sent, or buffer
+it while offline
+*/
+func (b *binding) sendOrBuffer(msg *protocol.Message, args []interface{}) (*Channel, error) {
+	b.offlineLock.Lock()
+	defer b.offlineLock.Unlock()
+
+	if b.ready != nil && b.ready.IsAlive() {
+		if err := send(msg, b.ready, eventArgs(args)); err != nil {
+			return nil, err
+		}
+		return b.ready, nil
+	}
+	return nil, b.buffer(offlineEmit{method: msg.Method, args: eventArgs(args)})
+}
+
+/**
+Keep emit until a channel connects, the policy applies when the buffer is
+full. Called with the offline lock held
+*/
+func (b *binding) buffer(emit offlineEmit) error {
+	size, policy := 0, OfflineDropOldest
+	if b.settings != nil {
+		size, policy = b.settings()
+	}
+	if size <= 0 {
+		return errorNotConnected
+	}
+
+	if len(b.offline) >= size {
+		switch policy {
+		case OfflineDropNewest:
+			glog.V(2).Infof("Offline buffer full, dropping %q", emit.method)
+			if emit.ack != nil {
+				//the caller of an ack request waits for it, it is told
+				return ErrOfflineBufferFull
+			}
+			return nil
+		case OfflineError:
+			return ErrOfflineBufferFull
+		default:
+			dropped := b.offline[0]
+			glog.V(2).Infof("Offline buffer full, dropping %q", dropped.method)
+			if dropped.ack != nil {
+				dropped.ack.complete("", ErrOfflineBufferFull)
+			}
+			b.offline = b.offline[1:]
+		}
+	}
+	b.offline = append(b.offline, emit)
+	return nil
+}
+
+// EmitContext - Emit, unless ctx is already done
+func (b *binding) EmitContext(ctx context.Context, method string, args ...interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.Emit(method, args...)
+}
+
+// Ack - Send a message over the current connection, expect a response
+// - while disconnected or connecting the request is buffered with the emits,
+// the timeout includes the wait for the connection
+func (b *binding) Ack(method string, args interface{}, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	result, err := b.AckContext(ctx, method, args)
+	if err == context.DeadlineExceeded {
+		return "", errorSendTimeout
+	}
+	return result, err
+}
+
+// AckContext - Send a message over the current connection, wait for the response until ctx is done
+func (b *binding) AckContext(ctx context.Context, method string, args interface{}) (string, error) {
+	return b.AckAsync(ctx, method, args).Wait()
+}
+
+// AckAsync - Send a message over the current connection without waiting for the response
+// - a buffered request fails with ErrOfflineBufferFull when the buffer drops it
+func (b *binding) AckAsync(ctx context.Context, method string, args interface{}) *AckFuture {
+	if err := ctx.Err(); err != nil {
+		return failedAck(method, err)
+	}
+
+	b.offlineLock.Lock()
+	if c := b.ready; c != nil && c.IsAlive() {
+		b.offlineLock.Unlock()
+		return c.AckAsync(ctx, method, args)
+	}
+	//sent once connected, see flush
+	f := &AckFuture{method: method, done: make(chan struct{})}
+	err := b.buffer(offlineEmit{method: method, args: args, ack: f})
+	b.offlineLock.Unlock()
+
+	if err != nil {
+		f.complete("", err)
+		return f
+	}
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-f.Done():
+			case <-ctx.Done():
+				f.complete("", ctx.Err())
+			}
+		}()
+	}
+	return f
+}
+
+// EmitWithAck - Send a message over the current connection, callback gets the response
+func (b *binding) EmitWithAck(method string, args interface{},
+	callback func(result string, err error)) *AckFuture {
+	f := b.AckAsync(context.Background(), method, args)
+	go func() {
+		callback(f.Wait())
+	}()
+	return f
+}
+
+// AckInto - Send a message over the current connection, decode the response into out
+func (b *binding) AckInto(ctx context.Context, method string, args interface{}, out ...interface{}) error {
+	result, err := b.AckContext(ctx, method, args)
+	if err != nil {
+		return err
+	}
+	return decodeAck(method, result, out)
+}
+
+// AckResult - Send a message over the current connection, decode the response
+// into out or return the error it carries
+func (b *binding) AckResult(ctx context.Context, method string, args interface{}, out ...interface{}) error {
+	result, err := b.AckContext(ctx, method, args)
+	if err != nil {
+		return err
+	}
+	if c := b.current(); c != nil {
+		return c.decodeAckResult(method, result, out)
+	}
+	return decodeAck(method, result, out)
+}
+
+/**
+c is connected: emits go to it from now on, starting with the ones
+buffered while offline
+*/
+func (b *binding) flush(c *Channel) {
+	b.offlineLock.Lock()
+	b.ready = c
+	sent := make([]*protocol.Message, 0, len(b.offline))
+	for _, emit := range b.offline {
+		msg := &protocol.Message{Type: protocol.MessageTypeEmit, Method: emit.method}
+		var request *AckFuture
+		if emit.ack != nil {
+			select {
+			case <-emit.ack.Done():
+				//the caller stopped waiting
+				continue
+			default:
+			}
+			request = c.ack.newFuture(emit.method)
+			msg.Type, msg.AckID = protocol.MessageTypeAckRequest, request.id
+		}
+		if err := send(msg, c, emit.args); err != nil {
+			glog.Errorf("Failed to send buffered %q: %s", emit.method, err)
+			if request != nil {
+				request.complete("", err)
+				emit.ack.complete("", err)
+			}
+			continue
+		}
+		if request != nil {
+			go relayAck(emit.ack, request)
+		}
+		sent = append(sent, msg)
+	}
+	b.offline = nil
+	b.offlineLock.Unlock()
+
+	for _, msg := range sent {
+		notifyOutgoing(c, msg)
+	}
+	if b.onConnected != nil {
+		b.onConnected()
+	}
+}
+
+/**
+Pass the outcome of the request sent for a buffered ack to the future of its
+caller, the request is cancelled when the caller stops waiting
+*/
+func relayAck(pending, request *AckFuture) {
+	select {
+	case <-request.Done():
+		pending.complete(request.Wait())
+	case <-pending.Done():
+		request.Cancel()
+	}
+}
+
+/**
+The namespace is no longer connected over sess, emits are buffered again
+*/
+func (b *binding) unready(sess *session) {
+	b.offlineLock.Lock()
+	if b.ready != nil && b.ready.session == sess {
+		b.ready = nil
+	}
+	b.offlineLock.Unlock()
+}
+
+/**
+The namespace of c is connected, called before the OnConnection handler
+*/
+func flushOffline(c *Channel) {
+	if c.owner != nil {
+		c.owner.flush(c)
+	}
+}
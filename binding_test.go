@@ -0,0 +1,194 @@
+package gosio
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gnabgib/go-sio/protocol"
+	"github.com/gnabgib/go-sio/transport"
+	"github.com/gorilla/websocket"
+)
+
+func TestOfflinePolicies(t *testing.T) {
+	tests := []struct {
+		policy   OfflinePolicy
+		buffered []string
+		err      error
+	}{
+		{OfflineDropOldest, []string{"b", "c"}, nil},
+		{OfflineDropNewest, []string{"a", "b"}, nil},
+		{OfflineError, []string{"a", "b"}, ErrOfflineBufferFull},
+	}
+	for _, test := range tests {
+		policy := test.policy
+		b := &binding{settings: func() (int, OfflinePolicy) { return 2, policy }}
+		for _, method := range []string{"a", "b"} {
+			if err := b.Emit(method); err != nil {
+				t.Fatalf("policy %d: Emit(%q) = %v", policy, method, err)
+			}
+		}
+		if err := b.Emit("c"); err != test.err {
+			t.Errorf("policy %d: Emit on a full buffer = %v, want %v", policy, err, test.err)
+		}
+		var buffered []string
+		for _, emit := range b.offline {
+			buffered = append(buffered, emit.method)
+		}
+		if !reflect.DeepEqual(buffered, test.buffered) {
+			t.Errorf("policy %d: buffered %v, want %v", policy, buffered, test.buffered)
+		}
+	}
+
+	//without a buffer nothing is kept
+	b := &binding{settings: func() (int, OfflinePolicy) { return 0, OfflineDropOldest }}
+	if err := b.Emit("a"); err != errorNotConnected || len(b.offline) != 0 {
+		t.Fatalf("Emit without buffer = %v, buffered %d", err, len(b.offline))
+	}
+}
+
+func TestOfflineAcks(t *testing.T) {
+	tests := []struct {
+		policy  OfflinePolicy
+		dropped []int
+	}{
+		//the oldest request fails, the caller of a dropped one is told
+		{OfflineDropOldest, []int{0}},
+		{OfflineDropNewest, []int{2}},
+		{OfflineError, []int{2}},
+	}
+	for _, test := range tests {
+		policy := test.policy
+		b := &binding{settings: func() (int, OfflinePolicy) { return 2, policy }}
+		futures := []*AckFuture{
+			b.AckAsync(context.Background(), "a", nil),
+			b.AckAsync(context.Background(), "b", nil),
+			b.AckAsync(context.Background(), "c", nil),
+		}
+		for _, i := range test.dropped {
+			if _, err := futures[i].Wait(); err != ErrOfflineBufferFull {
+				t.Errorf("policy %d: request %d failed with %v", policy, i, err)
+			}
+		}
+		if len(b.offline) != 2 {
+			t.Errorf("policy %d: %d buffered", policy, len(b.offline))
+		}
+	}
+
+	b := &binding{settings: func() (int, OfflinePolicy) { return 0, OfflineDropOldest }}
+	if _, err := b.AckAsync(context.Background(), "a", nil).Wait(); err != errorNotConnected {
+		t.Fatalf("ack without buffer: %v", err)
+	}
+}
+
+func TestAckBeforeConnect(t *testing.T) {
+	connect := make(chan bool)
+	packets := make(chan string, 8)
+	srv, u := fakeServer(t, func(ws *websocket.Conn, r *http.Request) {
+		writePacket(ws, testHandshake)
+		//the client asks for the namespace, the reply waits
+		packets <- readPacket(ws, time.Second)
+		<-connect
+		writePacket(ws, `40{"sid":"a"}`)
+		for p := readPacket(ws, time.Second); p != ""; p = readPacket(ws, time.Second) {
+			packets <- p
+			if m, err := protocol.Decode(p); err == nil && m.Type == protocol.MessageTypeAckRequest {
+				writePacket(ws, protocol.MustEncode(&protocol.Message{Type: protocol.MessageTypeAckResponse, AckID: m.AckID, Args: `"ok"`}))
+			}
+		}
+	})
+	defer srv.Close()
+
+	c := New(u, transport.GetDefaultWebsocketTransport())
+	c.Version = EIO4
+	connected := make(chan bool, 1)
+	c.OnConnect(func(ch *Channel) { connected <- true })
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if p := <-packets; p != "40" {
+		t.Fatalf("first packet %q", p)
+	}
+	//buffered with the emits until the namespace is connected
+	early := c.AckAsync(context.Background(), "ack", "early")
+	c.Emit("emit", "early")
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := c.AckContext(ctx, "ack", "expired"); err != context.DeadlineExceeded {
+		t.Fatalf("ack waiting for the connection: %v", err)
+	}
+	select {
+	case p := <-packets:
+		t.Fatalf("%q sent before the connect reply", p)
+	default:
+	}
+
+	close(connect)
+	<-connected
+	if result, err := early.Wait(); err != nil || result != `"ok"` {
+		t.Fatalf("buffered ack %q %v", result, err)
+	}
+	result, err := c.AckContext(context.Background(), "ack", "late")
+	if err != nil || result != `"ok"` {
+		t.Fatalf("ack once connected %q %v", result, err)
+	}
+
+	//in order, without the request its caller stopped waiting for
+	want := []string{`["ack","early"]`, `42["emit","early"]`, `["ack","late"]`}
+	for _, w := range want {
+		p := <-packets
+		if !strings.HasPrefix(p, "42") || !strings.HasSuffix(p, w) {
+			t.Fatalf("packet %q, want %q", p, w)
+		}
+	}
+}
+
+func TestOfflineReplay(t *testing.T) {
+	var dials int32
+	replayed := make(chan string, 8)
+	srv, u := fakeServer(t, func(ws *websocket.Conn, r *http.Request) {
+		writePacket(ws, testHandshake)
+		writePacket(ws, "40")
+		if atomic.AddInt32(&dials, 1) == 1 {
+			//lost connection, the client dials again
+			return
+		}
+		for p := readPacket(ws, time.Second); p != ""; p = readPacket(ws, time.Second) {
+			replayed <- p
+		}
+	})
+	defer srv.Close()
+
+	c := New(u, transport.GetDefaultWebsocketTransport())
+	c.Reconnection = true
+	c.ReconnectionDelay = 50 * time.Millisecond
+	c.OnDisconnect(func(ch *Channel) {
+		for _, method := range []string{"one", "two", "three"} {
+			if err := c.Emit(method, method); err != nil {
+				t.Errorf("Emit(%q) while offline: %v", method, err)
+			}
+		}
+	})
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for _, method := range []string{"one", "two", "three"} {
+		want := protocol.MustEncode(&protocol.Message{Type: protocol.MessageTypeEmit, Method: method, Args: `"` + method + `"`})
+		select {
+		case p := <-replayed:
+			if p != want {
+				t.Fatalf("replayed %q, want %q", p, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%q not replayed", method)
+		}
+	}
+}
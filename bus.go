@@ -0,0 +1,408 @@
+package gosio
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	defaultBusTimeout = time.Second
+
+	busHello     = "hello"
+	busBroadcast = "broadcast"
+	busFetch     = "fetch"
+	busPeers     = "peers"
+	busSockets   = "sockets"
+	busEmit      = "emit"
+)
+
+var (
+	errorFetchTimeout    = errors.New("Timeout waiting for the sockets of the other nodes")
+	errorBusNotConnected = errors.New("Bus adapter not connected to its hub")
+)
+
+/**
+Message exchanged on the bus, one JSON object per line. Node is the sender,
+To the only recipient when set, ID pairs a fetch with its replies
+*/
+type busFrame struct {
+	Type    string           `json:"type"`
+	Node    string           `json:"node,omitempty"`
+	To      string           `json:"to,omitempty"`
+	ID      uint64           `json:"id,omitempty"`
+	Count   int              `json:"count,omitempty"`
+	Opts    BroadcastOptions `json:"opts"`
+	Method  string           `json:"method,omitempty"`
+	Args    json.RawMessage  `json:"args,omitempty"`
+	Sockets []SocketInfo     `json:"sockets,omitempty"`
+}
+
+/**
+End of a bus connection, writes are serialized
+*/
+type busPeer struct {
+	node string
+	conn net.Conn
+	enc  *json.Encoder
+	lock sync.Mutex
+}
+
+func newBusPeer(conn net.Conn) *busPeer {
+	return &busPeer{conn: conn, enc: json.NewEncoder(conn)}
+}
+
+func (p *busPeer) write(f *busFrame) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.enc.Encode(f)
+}
+
+// BusHub - relays the messages of the bus adapters connected to it, the
+// nodes of these adapters share their broadcasts
+type BusHub struct {
+	listener net.Listener
+	peers    map[*busPeer]struct{}
+	lock     sync.Mutex
+}
+
+// ListenBus - Start a hub on the given network ("tcp" or "unix") and address
+func ListenBus(network, address string) (*BusHub, error) {
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &BusHub{
+		listener: listener,
+		peers:    make(map[*busPeer]struct{}),
+	}
+	go h.serve()
+	return h, nil
+}
+
+// Addr - address the hub listens on
+func (h *BusHub) Addr() net.Addr {
+	return h.listener.Addr()
+}
+
+// Close - stop listening and drop the connected adapters
+func (h *BusHub) Close() error {
+	err := h.listener.Close()
+
+	h.lock.Lock()
+	for p := range h.peers {
+		p.conn.Close()
+	}
+	h.lock.Unlock()
+	return err
+}
+
+func (h *BusHub) serve() {
+	for {
+		conn, err := h.listener.Accept()
+		if err != nil {
+			return
+		}
+		go h.relay(conn)
+	}
+}
+
+/**
+Forward what an adapter sends to the other ones, until it disconnects
+*/
+func (h *BusHub) relay(conn net.Conn) {
+	p := newBusPeer(conn)
+	h.lock.Lock()
+	h.peers[p] = struct{}{}
+	h.lock.Unlock()
+
+	defer func() {
+		h.lock.Lock()
+		delete(h.peers, p)
+		h.lock.Unlock()
+		conn.Close()
+	}()
+
+	dec := json.NewDecoder(conn)
+	for {
+		var f busFrame
+		if err := dec.Decode(&f); err != nil {
+			glog.V(2).Infof("Bus node %q left: %s", p.node, err)
+			return
+		}
+
+		if f.Type == busHello {
+			h.lock.Lock()
+			p.node = f.Node
+			h.lock.Unlock()
+			continue
+		}
+		h.forward(p, &f)
+	}
+}
+
+func (h *BusHub) forward(from *busPeer, f *busFrame) {
+	h.lock.Lock()
+	targets := make([]*busPeer, 0, len(h.peers))
+	for p := range h.peers {
+		if p == from || p.node == "" || (f.To != "" && p.node != f.To) {
+			continue
+		}
+		targets = append(targets, p)
+	}
+	h.lock.Unlock()
+
+	if f.Type == busFetch {
+		//the node asking knows how many replies to wait for
+		if err := from.write(&busFrame{Type: busPeers, ID: f.ID, Count: len(targets)}); err != nil {
+			glog.Errorf("Failed to write to bus node %q: %s", from.node, err)
+		}
+	}
+	for _, p := range targets {
+		if err := p.write(f); err != nil {
+			glog.Errorf("Failed to write to bus node %q: %s", p.node, err)
+		}
+	}
+}
+
+// BusAdapter - links the nodes whose adapters are connected to the same BusHub,
+// over TCP or a Unix socket
+// - rooms stay local, broadcasts, FetchSockets and ServerSideEmit reach every node
+// - arguments travel as JSON, binary ones reach the other nodes as base64 strings
+// - Broadcast, FetchSockets and ServerSideEmit fail until Init reached the hub
+type BusAdapter struct {
+	local   *MemoryAdapter
+	network string
+	address string
+
+	// Timeout - how long FetchSockets waits for the other nodes
+	Timeout time.Duration
+
+	node   Node
+	peer   *busPeer
+	closed int32
+
+	lastFetch   uint64
+	fetches     map[uint64]*pendingFetch
+	fetchesLock sync.Mutex
+}
+
+/**
+Replies awaited by FetchSockets, expected is unknown (-1) until the hub tells
+*/
+type pendingFetch struct {
+	sockets  []SocketInfo
+	expected int
+	replies  int
+	done     chan struct{}
+	finished bool
+}
+
+// NewBusAdapter - adapter connecting to the hub at the given network ("tcp"
+// or "unix") and address once the server uses it
+func NewBusAdapter(network, address string) *BusAdapter {
+	return &BusAdapter{
+		local:   NewMemoryAdapter(),
+		network: network,
+		address: address,
+		Timeout: defaultBusTimeout,
+		fetches: make(map[uint64]*pendingFetch),
+	}
+}
+
+// Init - connect to the hub
+func (a *BusAdapter) Init(node Node) error {
+	a.local.Init(node)
+	a.node = node
+
+	conn, err := net.Dial(a.network, a.address)
+	if err != nil {
+		return err
+	}
+	peer := newBusPeer(conn)
+	peer.node = node.ID()
+	if err := peer.write(&busFrame{Type: busHello, Node: node.ID()}); err != nil {
+		conn.Close()
+		return err
+	}
+	a.peer = peer
+
+	go a.read(json.NewDecoder(conn))
+	return nil
+}
+
+// AddAll - the client joins the rooms
+func (a *BusAdapter) AddAll(id string, rooms []string) {
+	a.local.AddAll(id, rooms)
+}
+
+// Del - the client leaves the room
+func (a *BusAdapter) Del(id, room string) {
+	a.local.Del(id, room)
+}
+
+// DelAll - the client leaves every room
+func (a *BusAdapter) DelAll(id string) {
+	a.local.DelAll(id)
+}
+
+// Rooms - rooms of the local client, sorted
+func (a *BusAdapter) Rooms(id string) []string {
+	return a.local.Rooms(id)
+}
+
+// Broadcast - emit to the matching clients of this node, then to the other nodes
+func (a *BusAdapter) Broadcast(opts BroadcastOptions, method string, args []interface{}) error {
+	//not installed, or the hub could not be reached
+	if a.peer == nil {
+		return errorBusNotConnected
+	}
+	err := a.local.Broadcast(opts, method, args)
+	if opts.Local {
+		return err
+	}
+
+	data, jsonErr := json.Marshal(args)
+	if jsonErr != nil {
+		return jsonErr
+	}
+	f := &busFrame{Type: busBroadcast, Node: a.node.ID(), Opts: opts, Method: method, Args: data}
+	if busErr := a.peer.write(f); busErr != nil && err == nil {
+		err = busErr
+	}
+	return err
+}
+
+// FetchSockets - the matching clients of every node, the ones found so far
+// are returned with an error when some nodes do not answer in time
+func (a *BusAdapter) FetchSockets(opts BroadcastOptions) ([]SocketInfo, error) {
+	if a.peer == nil {
+		return nil, errorBusNotConnected
+	}
+	sockets, err := a.local.FetchSockets(opts)
+	if err != nil || opts.Local {
+		return sockets, err
+	}
+
+	wait := &pendingFetch{expected: -1, done: make(chan struct{})}
+	a.fetchesLock.Lock()
+	a.lastFetch++
+	id := a.lastFetch
+	a.fetches[id] = wait
+	a.fetchesLock.Unlock()
+
+	defer func() {
+		a.fetchesLock.Lock()
+		delete(a.fetches, id)
+		a.fetchesLock.Unlock()
+	}()
+
+	if err := a.peer.write(&busFrame{Type: busFetch, Node: a.node.ID(), ID: id, Opts: opts}); err != nil {
+		return sockets, err
+	}
+
+	select {
+	case <-wait.done:
+	case <-time.After(a.Timeout):
+		err = errorFetchTimeout
+	}
+
+	a.fetchesLock.Lock()
+	sockets = append(sockets, wait.sockets...)
+	a.fetchesLock.Unlock()
+	return sockets, err
+}
+
+// ServerSideEmit - call the OnServerSideEmit handlers of the other nodes
+func (a *BusAdapter) ServerSideEmit(method string, args []interface{}) error {
+	if a.peer == nil {
+		return errorBusNotConnected
+	}
+	data, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	return a.peer.write(&busFrame{Type: busEmit, Node: a.node.ID(), Method: method, Args: data})
+}
+
+// Close - disconnect from the hub
+func (a *BusAdapter) Close() error {
+	atomic.StoreInt32(&a.closed, 1)
+	if a.peer == nil {
+		return nil
+	}
+	return a.peer.conn.Close()
+}
+
+/**
+Handle what the other nodes send, until the hub connection is lost
+*/
+func (a *BusAdapter) read(dec *json.Decoder) {
+	for {
+		var f busFrame
+		if err := dec.Decode(&f); err != nil {
+			if atomic.LoadInt32(&a.closed) == 0 {
+				glog.Errorf("Bus connection lost: %s", err)
+			}
+			return
+		}
+
+		switch f.Type {
+		case busBroadcast:
+			var values []json.RawMessage
+			if err := json.Unmarshal(f.Args, &values); err != nil {
+				glog.Errorf("Failed to decode broadcast %q: %s", f.Method, err)
+				continue
+			}
+			args := make([]interface{}, len(values))
+			for i, value := range values {
+				args[i] = value
+			}
+			if err := a.local.Broadcast(f.Opts, f.Method, args); err != nil {
+				glog.V(2).Infof("Failed to deliver broadcast %q: %s", f.Method, err)
+			}
+		case busFetch:
+			sockets, _ := a.local.FetchSockets(f.Opts)
+			reply := &busFrame{Type: busSockets, Node: a.node.ID(), To: f.Node, ID: f.ID, Sockets: sockets}
+			if err := a.peer.write(reply); err != nil {
+				glog.Errorf("Failed to answer fetch of %q: %s", f.Node, err)
+			}
+		case busPeers:
+			a.fetched(f.ID, nil, f.Count)
+		case busSockets:
+			a.fetched(f.ID, f.Sockets, -1)
+		case busEmit:
+			a.node.ServerSide(f.Method, f.Args)
+		}
+	}
+}
+
+/**
+Record a reply (or the number of replies, when peers >= 0) of a pending fetch
+*/
+func (a *BusAdapter) fetched(id uint64, sockets []SocketInfo, peers int) {
+	a.fetchesLock.Lock()
+	defer a.fetchesLock.Unlock()
+
+	wait, ok := a.fetches[id]
+	if !ok || wait.finished {
+		return
+	}
+	if peers >= 0 {
+		wait.expected = peers
+	} else {
+		wait.sockets = append(wait.sockets, sockets...)
+		wait.replies++
+	}
+	if wait.expected >= 0 && wait.replies >= wait.expected {
+		wait.finished = true
+		close(wait.done)
+	}
+}
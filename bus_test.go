@@ -0,0 +1,148 @@
+package gosio
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+/**
+Adapter of a new node connected to the hub, once the hub knows the node
+*/
+func busNode(t *testing.T, h *BusHub, id string) (*BusAdapter, *recordingNode) {
+	a := NewBusAdapter("tcp", h.Addr().String())
+	n := newRecordingNode(id)
+	if err := a.Init(n); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(5 * time.Millisecond) {
+		h.lock.Lock()
+		known := false
+		for p := range h.peers {
+			known = known || p.node == id
+		}
+		h.lock.Unlock()
+		if known {
+			return a, n
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("node %s unknown to the hub", id)
+		}
+	}
+}
+
+func nextDelivery(t *testing.T, n *recordingNode) delivery {
+	select {
+	case d := <-n.deliveries:
+		return d
+	case <-time.After(time.Second):
+		t.Fatalf("nothing delivered to %s", n.id)
+		return delivery{}
+	}
+}
+
+func TestBusAdapterRelay(t *testing.T) {
+	h, err := ListenBus("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	a1, n1 := busNode(t, h, "n1")
+	defer a1.Close()
+	a2, n2 := busNode(t, h, "n2")
+	defer a2.Close()
+
+	a1.AddAll("x", []string{"x", "room"})
+	a2.AddAll("y", []string{"y", "room"})
+	a2.AddAll("z", []string{"z", "other"})
+
+	//rooms are matched on every node
+	if err := a1.Broadcast(BroadcastOptions{Rooms: []string{"room", "other"}, Except: []string{"z"}}, "news", []interface{}{"hi", 2}); err != nil {
+		t.Fatal(err)
+	}
+	if d := nextDelivery(t, n1); !reflect.DeepEqual(d.ids, []string{"x"}) || d.method != "news" {
+		t.Fatalf("local delivery %+v", d)
+	}
+	if d := nextDelivery(t, n2); !reflect.DeepEqual(d.ids, []string{"y"}) || d.method != "news" || d.args != `["hi",2]` {
+		t.Fatalf("relayed delivery %+v", d)
+	}
+
+	//a local broadcast stays on its node
+	if err := a2.Broadcast(BroadcastOptions{Local: true}, "local", nil); err != nil {
+		t.Fatal(err)
+	}
+	if d := nextDelivery(t, n2); !reflect.DeepEqual(d.ids, []string{"y", "z"}) || d.method != "local" {
+		t.Fatalf("local broadcast %+v", d)
+	}
+	select {
+	case d := <-n1.deliveries:
+		t.Fatalf("local broadcast relayed %+v", d)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	sockets, err := a1.FetchSockets(BroadcastOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(sockets, func(i, j int) bool { return sockets[i].ID < sockets[j].ID })
+	want := []SocketInfo{
+		{ID: "x", Rooms: []string{"room", "x"}, Node: "n1"},
+		{ID: "y", Rooms: []string{"room", "y"}, Node: "n2"},
+		{ID: "z", Rooms: []string{"other", "z"}, Node: "n2"},
+	}
+	if !reflect.DeepEqual(sockets, want) {
+		t.Fatalf("sockets %+v", sockets)
+	}
+	if sockets, err := a2.FetchSockets(BroadcastOptions{Rooms: []string{"room"}}); err != nil || len(sockets) != 2 {
+		t.Fatalf("sockets in room %+v %v", sockets, err)
+	}
+
+	if err := a1.ServerSideEmit("sync", []interface{}{1}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-n2.serverSide:
+		if got != "sync[1]" {
+			t.Fatalf("server side emit %q", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("server side emit not relayed")
+	}
+}
+
+func TestBusAdapterNotConnected(t *testing.T) {
+	h, err := ListenBus("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := h.Addr().String()
+	h.Close()
+
+	failed := NewBusAdapter("tcp", address)
+	if err := failed.Init(newRecordingNode("n1")); err == nil {
+		t.Fatal("Init reached a closed hub")
+	}
+	for name, a := range map[string]*BusAdapter{"failed": failed, "not installed": NewBusAdapter("tcp", address)} {
+		if err := a.Broadcast(BroadcastOptions{}, "news", nil); err != errorBusNotConnected {
+			t.Errorf("%s: Broadcast error %v", name, err)
+		}
+		if _, err := a.FetchSockets(BroadcastOptions{}); err != errorBusNotConnected {
+			t.Errorf("%s: FetchSockets error %v", name, err)
+		}
+		if err := a.ServerSideEmit("sync", nil); err != errorBusNotConnected {
+			t.Errorf("%s: ServerSideEmit error %v", name, err)
+		}
+		if err := a.Close(); err != nil {
+			t.Errorf("%s: Close error %v", name, err)
+		}
+	}
+
+	s := NewServer(nil)
+	if err := s.SetAdapter(failed); err == nil {
+		t.Fatal("SetAdapter with an unreachable hub")
+	}
+	if err := s.Emit("news"); err != nil {
+		t.Fatalf("the previous adapter is kept: %v", err)
+	}
+}
@@ -1,21 +1,36 @@
 package gosio
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"reflect"
 )
 
+// AckFunc - Last parameter of a handler answering an ack request on its own
+// time, e.g. func(c *Channel, req Req, ack AckFunc). The values given are the
+// response, only the first call of any handler of the request is sent
+type AckFunc func(values ...interface{})
+
 type caller struct {
-	Func        reflect.Value
-	Args        reflect.Type
-	ArgsPresent bool
-	Out         bool
+	Func         reflect.Value
+	Args         []reflect.Type
+	ArgsPresent  bool
+	Variadic     bool
+	RoutePresent bool
+	AckType      reflect.Type
+	Out          bool
+	ErrOut       bool
 }
 
 var (
 	errorCallerNotFunc     = errors.New("f is not function")
-	errorCallerNot2Args    = errors.New("f should have 1 or 2 args")
-	errorCallerMaxOneValue = errors.New("f should return not more than one value")
+	errorCallerNoChannel   = errors.New("f should take the channel as first arg")
+	errorCallerMaxOneValue = errors.New("f should return not more than a value and an error")
+
+	routeType = reflect.TypeOf(Route{})
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+	ackTypes  = []reflect.Type{reflect.TypeOf(AckFunc(nil)), reflect.TypeOf(func(...interface{}) {})}
 )
 
 /**
@@ -29,46 +44,124 @@ func newCaller(f interface{}) (*caller, error) {
 	}
 
 	fType := fVal.Type()
-	if fType.NumOut() > 1 {
-		return nil, errorCallerMaxOneValue
+	if fType.NumIn() == 0 {
+		return nil, errorCallerNoChannel
 	}
 
 	curCaller := &caller{
-		Func: fVal,
-		Out:  fType.NumOut() == 1,
+		Func:     fVal,
+		Variadic: fType.IsVariadic(),
+	}
+	switch {
+	case fType.NumOut() == 1 && fType.Out(0) == errorType:
+		curCaller.ErrOut = true
+	case fType.NumOut() == 1:
+		curCaller.Out = true
+	case fType.NumOut() == 2 && fType.Out(1) == errorType:
+		curCaller.Out, curCaller.ErrOut = true, true
+	case fType.NumOut() > 1:
+		return nil, errorCallerMaxOneValue
 	}
-	if fType.NumIn() == 1 {
-		curCaller.Args = nil
-		curCaller.ArgsPresent = false
-	} else if fType.NumIn() == 2 {
-		curCaller.Args = fType.In(1)
-		curCaller.ArgsPresent = true
-	} else {
-		return nil, errorCallerNot2Args
+	first := 1
+	if fType.NumIn() >= 2 && fType.In(1) == routeType {
+		//func(c *Channel, route Route, args...)
+		curCaller.RoutePresent = true
+		first++
 	}
+	last := fType.NumIn()
+	if last > first {
+		for _, t := range ackTypes {
+			if fType.In(last-1) == t {
+				//func(c *Channel, args..., ack AckFunc)
+				curCaller.AckType = t
+				last--
+				break
+			}
+		}
+	}
+	for i := first; i < last; i++ {
+		curCaller.Args = append(curCaller.Args, fType.In(i))
+	}
+	curCaller.ArgsPresent = len(curCaller.Args) > 0
 
 	return curCaller, nil
 }
 
 /**
-returns function parameter as it is present in it using reflection
+Decode the comma separated arguments of a message, one per parameter and the
+rest into the variadic one. Missing arguments get the zero value
 */
-func (c *caller) getArgs() interface{} {
-	return reflect.New(c.Args).Interface()
+func (c *caller) decodeArgs(data string) ([]reflect.Value, error) {
+	var values []json.RawMessage
+	if data != "" {
+		if err := json.Unmarshal([]byte("["+data+"]"), &values); err != nil {
+			return nil, err
+		}
+	}
+
+	fixed := len(c.Args)
+	if c.Variadic {
+		fixed--
+	}
+
+	args := make([]reflect.Value, 0, len(values))
+	for i := 0; i < fixed; i++ {
+		arg := reflect.New(c.Args[i])
+		if i < len(values) {
+			if err := json.Unmarshal(values[i], arg.Interface()); err != nil {
+				return nil, fmt.Errorf("arg %d: %w", i, err)
+			}
+		}
+		args = append(args, arg.Elem())
+	}
+	if c.Variadic {
+		elem := c.Args[fixed].Elem()
+		for i := fixed; i < len(values); i++ {
+			arg := reflect.New(elem)
+			if err := json.Unmarshal(values[i], arg.Interface()); err != nil {
+				return nil, fmt.Errorf("arg %d: %w", i, err)
+			}
+			args = append(args, arg.Elem())
+		}
+	}
+	return args, nil
 }
 
 /**
-calls function with given arguments from its representation using reflection
+Response of an ack request for what the function returned, a non nil
+error is encoded in the given convention
 */
-func (c *caller) callFunc(h *Channel, args interface{}) []reflect.Value {
-	//nil is untyped, so use the default empty value of correct type
-	if args == nil {
-		args = c.getArgs()
+func (c *caller) ackResponse(result []reflect.Value, format AckErrorFormat) eventArgs {
+	var values []interface{}
+	if c.Out {
+		values = append(values, result[0].Interface())
 	}
 
-	a := []reflect.Value{reflect.ValueOf(h), reflect.ValueOf(args).Elem()}
-	if !c.ArgsPresent {
-		a = a[0:1]
+	var err error
+	if c.ErrOut {
+		err, _ = result[len(result)-1].Interface().(error)
+	}
+	return eventArgs(format.EncodeAck(values, err))
+}
+
+/**
+calls function with given arguments from its representation using reflection,
+reply answers the ack request if any
+*/
+func (c *caller) callFunc(h *Channel, route Route, args []reflect.Value, reply func(interface{})) []reflect.Value {
+	a := []reflect.Value{reflect.ValueOf(h)}
+	if c.RoutePresent {
+		a = append(a, reflect.ValueOf(route))
+	}
+	a = append(a, args...)
+	if c.AckType != nil {
+		a = append(a, reflect.MakeFunc(c.AckType, func(in []reflect.Value) []reflect.Value {
+			//no-op when no response was requested
+			if reply != nil {
+				reply(eventArgs(in[0].Interface().([]interface{})))
+			}
+			return nil
+		}))
 	}
 
 	return c.Func.Call(a)
@@ -1,8 +1,12 @@
 package gosio
 
 import (
+	"context"
+	"net/http"
 	"net/url"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/gnabgib/go-sio/transport"
 )
@@ -11,14 +15,82 @@ const (
 	webSocketScheme = "ws"
 	pollingScheme   = "http"
 	sioPath         = "/socket.io/"
+
+	defaultReconnectionDelay    = time.Second
+	defaultReconnectionDelayMax = 5 * time.Second
+	defaultRandomizationFactor  = 0.5
+	defaultOfflineBuffer        = 100
+)
+
+// ProtocolVersion - Engine.IO protocol revision spoken on the wire
+type ProtocolVersion int
+
+const (
+	// EIO3 - Engine.IO v3, used by socket.io 2.x servers
+	EIO3 ProtocolVersion = 3
+	// EIO4 - Engine.IO v4, used by socket.io 3.x and 4.x servers
+	EIO4 ProtocolVersion = 4
 )
 
+// TokenProvider - Returns the token to connect with, called before every dial
+type TokenProvider func(ctx context.Context) (string, error)
+
 // Client holds connection details
+// - Emit, Ack, ID and IsAlive apply to the current connection
+// - handlers receive the Channel of the connection the message came from
 type Client struct {
 	event
-	Channel
+	binding
 	url *url.URL
 	tr  transport.Transport
+
+	// Version - protocol to speak, when zero the EIO parameter of the URL is used
+	Version ProtocolVersion
+	// Auth - payload of the namespace CONNECT packet (EIO4 only)
+	Auth interface{}
+	// Token - fresh token for every dial, reconnections included. It is sent as
+	// a bearer Authorization header (transports implementing ContextTransport)
+	// and as the token field of Auth when it is nil or a map
+	Token TokenProvider
+	// TokenQuery - query parameter carrying the token too, none when empty
+	TokenQuery string
+
+	// Reconnection - dial again when the connection is lost, unless the server
+	// disconnected the client or Close was called
+	Reconnection bool
+	// ReconnectionAttempts - attempts before giving up, 0 for no limit
+	ReconnectionAttempts int
+	// ReconnectionDelay - delay before the first attempt, doubled on every attempt
+	ReconnectionDelay time.Duration
+	// ReconnectionDelayMax - upper bound of the delay between attempts
+	ReconnectionDelayMax time.Duration
+	// RandomizationFactor - jitter of the delay, between 0 and 1
+	RandomizationFactor float64
+
+	// OfflineBuffer - emits kept while disconnected or connecting, sent in order
+	// once connected, 0 to return an error instead (namespace sockets included)
+	OfflineBuffer int
+	// OfflinePolicy - what to drop when the offline buffer is full
+	OfflinePolicy OfflinePolicy
+
+	// AckErrors - how errors returned by handlers are answered to ack requests
+	// and found by AckResult, AckErrorObject when nil (namespace sockets included)
+	AckErrors AckErrorFormat
+
+	// Workers - handlers running at the same time, 0 for a goroutine per
+	// message. Ignored by Dial2, which handles messages one at a time
+	Workers int
+	// OrderKey - events of the same key are handled in order when Workers is
+	// set, e.g. OrderByEvent, other events run on any free worker
+	OrderKey OrderKey
+
+	sequential bool
+	dialLock   sync.Mutex
+
+	//closed by Close to stop reconnecting
+	stop      chan struct{}
+	stopLock  sync.Mutex
+	reconnect reconnectHandlers
 }
 
 // GetURL - Convert a host/port/secure flag and params into a URL
@@ -44,53 +116,208 @@ func GetURL(host string, port int, secure bool, params *map[string]string) *url.
 // Dial - connect to server and initialize protocol
 // - You should use GetURL to generate the correct URL
 func New(url *url.URL, tr transport.Transport) *Client {
-	c := &Client{url: url, tr: tr}
-	c.initChannel()
+	c := &Client{
+		url:                  url,
+		tr:                   tr,
+		ReconnectionDelay:    defaultReconnectionDelay,
+		ReconnectionDelayMax: defaultReconnectionDelayMax,
+		RandomizationFactor:  defaultRandomizationFactor,
+		OfflineBuffer:        defaultOfflineBuffer,
+	}
 	c.initMethods()
-
-	// go workerLoop(&c.Channel, &c.event)
-	// go inLoop(&c.Channel, &c.event)
-	// go outLoop(&c.Channel, &c.event)
-	// go pinger(&c.Channel)
+	c.settings = c.offlineSettings
+	c.onConnected = c.connected
+	c.ackErrors = c.ackErrorSettings
 
 	return c
 }
 
 func (c *Client) Dial() error {
+	return c.DialContext(context.Background())
+}
+
+// DialContext - Dial, the connection attempt is aborted when ctx is done
+// - ctx does not outlive the dial, reconnections are not bound to it
+// - when the dial fails and Reconnection is set, the client keeps trying in the background
+func (c *Client) DialContext(ctx context.Context) error {
+	c.stopLock.Lock()
+	if c.stop == nil {
+		c.stop = make(chan struct{})
+	}
+	stop := c.stop
+	c.stopLock.Unlock()
+	c.resetAttempts()
 
-	c.initChannel()
-	//c.initMethods()
+	if _, err := c.dial(ctx, stop); err != nil {
+		//the channel never opened, there is nothing to disconnect
+		if c.Reconnection && err != errorClientClosed && ctx.Err() == nil {
+			go c.reconnectLoop(stop)
+		}
+		return err
+	}
 
+	return nil
+}
+
+/**
+Open a new channel and bind the client and its namespaces to it,
+the returned channel is not bound when the connection failed
+*/
+func (c *Client) dial(ctx context.Context, stop chan struct{}) (*Channel, error) {
+	c.dialLock.Lock()
+	defer c.dialLock.Unlock()
+
+	ch := &Channel{}
+	ch.initChannel()
+	ch.version = c.protocolVersion()
+	ch.auth = c.Auth
+	ch.sequentialInLoop = c.sequential
+	ch.events = &c.event
+	if c.Workers > 0 && !c.sequential {
+		ch.dispatcher = newDispatcher(c.Workers, c.OrderKey, ch.closed)
+	}
+
+	select {
+	case <-stop:
+		return ch, errorClientClosed
+	case <-ctx.Done():
+		return ch, ctx.Err()
+	default:
+	}
+
+	u := c.dialURL(ch.version)
+	if c.Token != nil {
+		token, err := c.Token(ctx)
+		if err != nil {
+			return ch, err
+		}
+		ctx = transport.WithRequestHeader(ctx, http.Header{"Authorization": {"Bearer " + token}})
+		ch.auth = authWithToken(c.Auth, token)
+		if c.TokenQuery != "" {
+			q := u.Query()
+			q.Set(c.TokenQuery, token)
+			u.RawQuery = q.Encode()
+		}
+	}
+
+	var conn transport.Connection
 	var err error
-	c.conn, err = c.tr.Connect(c.url)
+	if tr, ok := c.tr.(transport.ContextTransport); ok {
+		conn, err = tr.ConnectContext(ctx, u)
+	} else {
+		conn, err = c.tr.Connect(u)
+	}
 	if err != nil {
-		if c.onDisconnection != nil {
+		return ch, err
+	}
+	ch.conn = conn
 
-			c.onDisconnection(&c.Channel)
-		}
+	c.bind(ch)
+	c.bindSockets(ch)
 
-		return err
+	go workerLoop(ch, &c.event)
+	if ch.dispatcher != nil {
+		ch.dispatcher.start(ch, &c.event)
+	}
+	go inLoop(ch, &c.event)
+	go outLoop(ch, &c.event)
+	if ch.version == EIO3 {
+		//EIO4 servers ping the client, see pingWatchdog
+		go pinger(ch)
 	}
+	go c.supervise(ch, stop)
 
-	go workerLoop(&c.Channel, &c.event)
-	go inLoop(&c.Channel, &c.event)
-	go outLoop(&c.Channel, &c.event)
-	go pinger(&c.Channel)
+	return ch, nil
+}
 
-	return nil
+/**
+Size and policy of the offline buffers
+*/
+func (c *Client) offlineSettings() (int, OfflinePolicy) {
+	return c.OfflineBuffer, c.OfflinePolicy
+}
+
+/**
+Error convention of the ack requests and responses
+*/
+func (c *Client) ackErrorSettings() AckErrorFormat {
+	return c.AckErrors
+}
+
+/**
+Protocol version to dial with, falls back to the EIO parameter of the URL
+*/
+func (c *Client) protocolVersion() ProtocolVersion {
+	if c.Version != 0 {
+		return c.Version
+	}
+	if c.url.Query().Get("EIO") == strconv.Itoa(int(EIO4)) {
+		return EIO4
+	}
+	return EIO3
+}
+
+/**
+Copy of the client URL with the EIO parameter matching the protocol version
+*/
+func (c *Client) dialURL(version ProtocolVersion) *url.URL {
+	u := *c.url
+	q := u.Query()
+	q.Set("EIO", strconv.Itoa(int(version)))
+	u.RawQuery = q.Encode()
+	return &u
+}
+
+/**
+Auth payload carrying the token, auth is sent as is unless nil or a map
+*/
+func authWithToken(auth interface{}, token string) interface{} {
+	switch fields := auth.(type) {
+	case nil:
+		return map[string]interface{}{"token": token}
+	case map[string]interface{}:
+		merged := make(map[string]interface{}, len(fields)+1)
+		for k, v := range fields {
+			merged[k] = v
+		}
+		merged["token"] = token
+		return merged
+	case map[string]string:
+		merged := make(map[string]string, len(fields)+1)
+		for k, v := range fields {
+			merged[k] = v
+		}
+		merged["token"] = token
+		return merged
+	}
+	return auth
 }
 
 // Dial2 - Similar to Dial, but set sequentialInLoop to true in Channel
 // this will cause incoming message handling to be serialized.
 func (c *Client) Dial2() error {
-	err := c.Dial()
-	if err == nil {
-		c.Channel.sequentialInLoop = true
-	}
-	return err
+	c.dialLock.Lock()
+	c.sequential = true
+	c.dialLock.Unlock()
+
+	return c.Dial()
 }
 
-// Close client connection
+// Close client connection, stops reconnecting
 func (c *Client) Close() {
-	closeChannel(&c.Channel, &c.event)
+	c.stopLock.Lock()
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+	c.stopLock.Unlock()
+
+	//wait for a dial in progress, so its channel is closed too
+	c.dialLock.Lock()
+	ch := c.current()
+	c.dialLock.Unlock()
+
+	if ch != nil {
+		closeChannel(ch, &c.event, ReasonClientDisconnect, nil)
+	}
 }
@@ -0,0 +1,55 @@
+package gosio
+
+import (
+	"errors"
+)
+
+var (
+	// ErrDisconnected - pending acks fail with a *DisconnectError matching it
+	// (errors.Is) when the connection is closed
+	ErrDisconnected = errors.New("Disconnected")
+)
+
+// DisconnectReason - why a channel was closed
+type DisconnectReason string
+
+const (
+	// ReasonTransportError - the connection failed (read, write or upgrade error)
+	ReasonTransportError DisconnectReason = "transport error"
+	// ReasonServerDisconnect - the server closed the channel or refused to connect it
+	ReasonServerDisconnect DisconnectReason = "io server disconnect"
+	// ReasonClientDisconnect - closed on the client side (Close)
+	ReasonClientDisconnect DisconnectReason = "io client disconnect"
+	// ReasonPingTimeout - the server did not ping (EIO4) in time
+	ReasonPingTimeout DisconnectReason = "ping timeout"
+	// ReasonParseError - the server sent a packet that could not be decoded
+	ReasonParseError DisconnectReason = "parse error"
+	// ReasonBufferOverflow - too many messages waiting to be sent
+	ReasonBufferOverflow DisconnectReason = "buffer overflow"
+)
+
+// DisconnectError - outcome of an ack whose connection closed before the response
+type DisconnectError struct {
+	// Reason - why the connection was closed
+	Reason DisconnectReason
+	// Err - underlying error (e.g. of the transport), nil when there is none
+	Err error
+}
+
+func (e *DisconnectError) Error() string {
+	msg := ErrDisconnected.Error() + ": " + string(e.Reason)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Is - matches ErrDisconnected
+func (e *DisconnectError) Is(target error) bool {
+	return target == ErrDisconnected
+}
+
+// Unwrap - the underlying error
+func (e *DisconnectError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,65 @@
+package gosio
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gnabgib/go-sio/transport"
+	"github.com/gorilla/websocket"
+)
+
+func TestOnDisconnectReason(t *testing.T) {
+	srv, u := fakeServer(t, func(ws *websocket.Conn, r *http.Request) {
+		writePacket(ws, `0{"sid":"eng","upgrades":[],"pingInterval":20000,"pingTimeout":2000}`)
+		writePacket(ws, "40")
+		writePacket(ws, "41")
+		readPacket(ws, time.Second)
+	})
+	defer srv.Close()
+
+	c := New(u, transport.GetDefaultWebsocketTransport())
+	c.OnDisconnect(func(ch *Channel) { t.Error("replaced handler called") })
+	reasons := make(chan DisconnectReason, 1)
+	c.OnDisconnectReason(func(ch *Channel, reason DisconnectReason) { reasons <- reason })
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	select {
+	case reason := <-reasons:
+		if reason != ReasonServerDisconnect {
+			t.Fatalf("reason %q", reason)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no disconnect")
+	}
+}
+
+func TestOnDisconnect(t *testing.T) {
+	srv, u := fakeServer(t, func(ws *websocket.Conn, r *http.Request) {
+		writePacket(ws, `0{"sid":"eng","upgrades":[],"pingInterval":20000,"pingTimeout":2000}`)
+		writePacket(ws, "40")
+		writePacket(ws, "41")
+		readPacket(ws, time.Second)
+	})
+	defer srv.Close()
+
+	c := New(u, transport.GetDefaultWebsocketTransport())
+	closed := make(chan DisconnectReason, 1)
+	c.OnDisconnect(func(ch *Channel) { closed <- ch.DisconnectReason() })
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	select {
+	case reason := <-closed:
+		if reason != ReasonServerDisconnect {
+			t.Fatalf("reason %q", reason)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no disconnect")
+	}
+}
@@ -0,0 +1,95 @@
+package gosio
+
+import (
+	"encoding/json"
+	"hash/fnv"
+
+	"github.com/gnabgib/go-sio/protocol"
+)
+
+// OrderKey - Key of an incoming event, events with the same key are handled
+// one at a time in the order they arrived, an empty key leaves the event
+// unordered. args is the JSON array of the event arguments
+type OrderKey func(event string, args json.RawMessage) string
+
+// OrderByEvent - events of the same name are handled in order
+func OrderByEvent(event string, args json.RawMessage) string {
+	return event
+}
+
+/**
+Runs the handlers of a session on a bounded number of workers, the events
+of a key always go to the same worker, the others to the first one free
+*/
+type dispatcher struct {
+	queues []chan *protocol.Message
+	shared chan *protocol.Message
+	key    OrderKey
+	done   <-chan struct{}
+}
+
+func newDispatcher(workers int, key OrderKey, done <-chan struct{}) *dispatcher {
+	d := &dispatcher{
+		queues: make([]chan *protocol.Message, workers),
+		shared: make(chan *protocol.Message, queueBufferSize),
+		key:    key,
+		done:   done,
+	}
+	for i := range d.queues {
+		d.queues[i] = make(chan *protocol.Message, queueBufferSize)
+	}
+	return d
+}
+
+/**
+Start the workers, they stop once the session is closed
+*/
+func (d *dispatcher) start(c *Channel, e *event) {
+	for _, queue := range d.queues {
+		go d.work(c, e, queue)
+	}
+}
+
+/**
+Queue msg for the workers, blocks while its queue is full
+*/
+func (d *dispatcher) dispatch(c *Channel, e *event, msg *protocol.Message) {
+	if msg.Type == protocol.MessageTypeAckResponse {
+		//completing a waiter does not block, and handlers waiting for
+		//an ack must not wait for a free worker
+		if ch, h, ok := e.route(c, msg.Namespace); ok {
+			h.processIncomingMessage(ch, msg)
+		}
+		return
+	}
+
+	queue := d.shared
+	if d.key != nil {
+		if key := d.key(msg.Method, json.RawMessage("["+msg.Args+"]")); key != "" {
+			hash := fnv.New32a()
+			hash.Write([]byte(key))
+			queue = d.queues[hash.Sum32()%uint32(len(d.queues))]
+		}
+	}
+
+	select {
+	case queue <- msg:
+	case <-d.done:
+	}
+}
+
+func (d *dispatcher) work(c *Channel, e *event, queue chan *protocol.Message) {
+	for {
+		var msg *protocol.Message
+		select {
+		case msg = <-queue:
+		case msg = <-d.shared:
+		case <-d.done:
+			return
+		}
+
+		if ch, h, ok := e.route(c, msg.Namespace); ok {
+			h.processIncomingMessage(ch, msg)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package gosio
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gnabgib/go-sio/transport"
+	"github.com/gorilla/websocket"
+)
+
+// dispatchingClient returns a client of a fake server sending the given packets once
+// connected, handlers run on workers. stop closes both
+func dispatchingClient(t *testing.T, workers int, key OrderKey, packets []string) (c *Client, stop func()) {
+	srv, u := fakeServer(t, func(ws *websocket.Conn, r *http.Request) {
+		writePacket(ws, testHandshake)
+		writePacket(ws, "40")
+		for _, p := range packets {
+			writePacket(ws, p)
+		}
+		readPacket(ws, 5*time.Second)
+	})
+
+	c = New(u, transport.GetDefaultWebsocketTransport())
+	c.Workers = workers
+	c.OrderKey = key
+	return c, func() {
+		c.Close()
+		srv.Close()
+	}
+}
+
+// concurrency counts the handlers running at the same time
+type concurrency struct {
+	running int
+	max     int
+	lock    sync.Mutex
+}
+
+func (c *concurrency) enter() {
+	c.lock.Lock()
+	c.running++
+	if c.running > c.max {
+		c.max = c.running
+	}
+	c.lock.Unlock()
+}
+
+func (c *concurrency) leave() {
+	c.lock.Lock()
+	c.running--
+	c.lock.Unlock()
+}
+
+func TestDispatcherKeepsKeyOrder(t *testing.T) {
+	const n = 30
+	var packets []string
+	for i := 0; i < n; i++ {
+		packets = append(packets, fmt.Sprintf(`42["seq",%d]`, i), fmt.Sprintf(`42["other",%d]`, i))
+	}
+	seqOnly := func(event string, args json.RawMessage) string {
+		if event == "seq" {
+			return "seq"
+		}
+		return ""
+	}
+	c, stop := dispatchingClient(t, 4, seqOnly, packets)
+	defer stop()
+
+	seq := make(chan int, n)
+	others := make(chan int, n)
+	c.On("seq", func(ch *Channel, i int) {
+		//later events would overtake a slow handler without ordering
+		time.Sleep(time.Duration(n-i) * 100 * time.Microsecond)
+		seq <- i
+	})
+	c.On("other", func(ch *Channel, i int) { others <- i })
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < n; i++ {
+		select {
+		case got := <-seq:
+			if got != i {
+				t.Fatalf("seq %d handled at position %d", got, i)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("seq %d not handled", i)
+		}
+	}
+	for i := 0; i < n; i++ {
+		select {
+		case <-others:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%d unordered events handled, want %d", i, n)
+		}
+	}
+}
+
+func TestDispatcherRunsKeysConcurrently(t *testing.T) {
+	//with two workers, "a" and "b" hash to different ones
+	c, stop := dispatchingClient(t, 2, OrderByEvent, []string{`42["a"]`, `42["b"]`})
+	defer stop()
+
+	b := make(chan bool)
+	done := make(chan bool, 1)
+	c.On("a", func(ch *Channel) {
+		select {
+		case <-b:
+			done <- true
+		case <-time.After(2 * time.Second):
+			done <- false
+		}
+	})
+	c.On("b", func(ch *Channel) { close(b) })
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !<-done {
+		t.Fatal(`"b" waited for the handler of "a"`)
+	}
+}
+
+func TestDispatcherWorkerLimit(t *testing.T) {
+	const workers, n = 3, 20
+	var packets []string
+	for i := 0; i < n; i++ {
+		packets = append(packets, fmt.Sprintf(`42["job",%d]`, i))
+	}
+	c, stop := dispatchingClient(t, workers, nil, packets)
+	defer stop()
+
+	var running concurrency
+	handled := make(chan bool, n)
+	c.On("job", func(ch *Channel, i int) {
+		running.enter()
+		time.Sleep(20 * time.Millisecond)
+		running.leave()
+		handled <- true
+	})
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < n; i++ {
+		select {
+		case <-handled:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%d jobs handled, want %d", i, n)
+		}
+	}
+	running.lock.Lock()
+	defer running.lock.Unlock()
+	if running.max > workers {
+		t.Errorf("%d handlers at the same time, limit %d", running.max, workers)
+	}
+	if running.max < 2 {
+		t.Errorf("handlers never ran concurrently")
+	}
+}
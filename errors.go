@@ -0,0 +1,71 @@
+package gosio
+
+import (
+	"fmt"
+)
+
+const (
+	//longest packet excerpt in error messages
+	maxErrorSource = 100
+)
+
+// DecodeError - a packet received from the server could not be decoded
+type DecodeError struct {
+	// Source - the packet as received
+	Source string
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("Failed to decode %q: %s", excerpt(e.Source), e.Err)
+}
+
+// Unwrap - the decoding error
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// HandlerArgError - the arguments of an event do not fit the parameter of its handler
+type HandlerArgError struct {
+	Method string
+	// Source - the packet as received
+	Source string
+	Err    error
+}
+
+func (e *HandlerArgError) Error() string {
+	return fmt.Sprintf("Wrong arguments for %q in %q: %s", e.Method, excerpt(e.Source), e.Err)
+}
+
+// Unwrap - the unmarshalling error
+func (e *HandlerArgError) Unwrap() error {
+	return e.Err
+}
+
+// TransportError - reading from, writing to or upgrading the connection failed
+type TransportError struct {
+	// Op - "read", "write" or "upgrade"
+	Op string
+	// Packet - the packet being written, empty otherwise
+	Packet string
+	Err    error
+}
+
+func (e *TransportError) Error() string {
+	if e.Packet == "" {
+		return fmt.Sprintf("Failed to %s: %s", e.Op, e.Err)
+	}
+	return fmt.Sprintf("Failed to %s %q: %s", e.Op, excerpt(e.Packet), e.Err)
+}
+
+// Unwrap - the error of the transport
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+func excerpt(source string) string {
+	if len(source) > maxErrorSource {
+		return source[:maxErrorSource] + "..."
+	}
+	return source
+}
@@ -1,6 +1,25 @@
 package gosio
 
+import (
+	"encoding/json"
+)
+
 /**
 System handler function for internal event processing
 */
-type systemHandler func(c *Channel)
\ No newline at end of file
+type systemHandler func(c *Channel)
+
+/**
+Disconnect handler, with the reason of the disconnection
+*/
+type disconnectHandler func(c *Channel, reason DisconnectReason)
+
+/**
+Error handler, err is a *DecodeError, *HandlerArgError or *TransportError
+*/
+type errorHandler func(c *Channel, err error)
+
+/**
+Catch-all handler, args is the JSON array of the event arguments
+*/
+type anyHandler func(c *Channel, event string, args json.RawMessage)
@@ -0,0 +1,93 @@
+package gosio
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gnabgib/go-sio/transport"
+	"github.com/gorilla/websocket"
+)
+
+// fakeServer runs script for every websocket connection, the URL asks for EIO3
+func fakeServer(t *testing.T, script func(ws *websocket.Conn, r *http.Request)) (*httptest.Server, *url.URL) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := websocket.Upgrade(w, r, nil, 1024, 1024)
+		if err != nil {
+			t.Log(err)
+			return
+		}
+		defer ws.Close()
+		script(ws, r)
+	}))
+	u, _ := url.Parse(strings.Replace(srv.URL, "http", "ws", 1) + "/socket.io/?EIO=3&transport=websocket")
+	return srv, u
+}
+
+// readPacket returns the next text message, "" after timeout
+func readPacket(ws *websocket.Conn, timeout time.Duration) string {
+	ws.SetReadDeadline(time.Now().Add(timeout))
+	_, data, err := ws.ReadMessage()
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func writePacket(ws *websocket.Conn, packet string) {
+	ws.WriteMessage(websocket.TextMessage, []byte(packet))
+}
+
+// testServer serves a Server with a short ping interval, url is its websocket endpoint
+func testServer(t *testing.T) (*Server, *httptest.Server, string) {
+	tr := transport.GetDefaultWebsocketTransport()
+	tr.PingInterval = 200 * time.Millisecond
+	tr.PingTimeout = 200 * time.Millisecond
+	s := NewServer(tr)
+	hs := httptest.NewServer(s)
+	return s, hs, strings.Replace(hs.URL, "http", "ws", 1) + "/socket.io/"
+}
+
+// dialRaw opens a websocket to a test server without a client, the handshake
+// packet is read
+func dialRaw(t *testing.T, endpoint, query string) *websocket.Conn {
+	ws, _, err := websocket.DefaultDialer.Dial(endpoint+"?transport=websocket&"+query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := readPacket(ws, time.Second); !strings.HasPrefix(p, "0{") {
+		ws.Close()
+		t.Fatalf("handshake %q", p)
+	}
+	return ws
+}
+
+// readSkippingPings returns the next packet that is not a ping, pings are answered
+func readSkippingPings(ws *websocket.Conn, timeout time.Duration) string {
+	deadline := time.Now().Add(timeout)
+	for {
+		p := readPacket(ws, time.Until(deadline))
+		if p != "2" {
+			return p
+		}
+		writePacket(ws, "3")
+	}
+}
+
+// connectRaw dials a test server as an EIO4 client connected to the root
+// namespace, the socket id of the client is returned
+func connectRaw(t *testing.T, endpoint string) (*websocket.Conn, string) {
+	ws := dialRaw(t, endpoint, "EIO=4")
+	writePacket(ws, "40")
+	p := readSkippingPings(ws, time.Second)
+	var reply connectReply
+	if !strings.HasPrefix(p, "40") || json.Unmarshal([]byte(p[2:]), &reply) != nil {
+		ws.Close()
+		t.Fatalf("connect reply %q", p)
+	}
+	return ws, reply.Sid
+}
@@ -0,0 +1,371 @@
+package gosio
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	// hash functions of the supported algorithms
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+var (
+	errorTokenMissing     = errors.New("Token missing")
+	errorTokenMalformed   = errors.New("Token malformed")
+	errorTokenSignature   = errors.New("Token signature invalid")
+	errorTokenExpired     = errors.New("Token expired")
+	errorTokenNoExpiry    = errors.New("Token without expiry")
+	errorTokenNotYetValid = errors.New("Token not valid yet")
+	errorTokenIssuer      = errors.New("Token issuer not accepted")
+	errorTokenAudience    = errors.New("Token audience not accepted")
+	errorNoPEMKey         = errors.New("No PEM encoded key found")
+	errorEmptySecret      = errors.New("Empty token secret")
+)
+
+// Claims - payload of a JSON Web Token, numbers are float64
+type Claims map[string]interface{}
+
+// String - claim of the given name, empty when missing or not a string
+func (c Claims) String(name string) string {
+	value, _ := c[name].(string)
+	return value
+}
+
+// Subject - the sub claim
+func (c Claims) Subject() string {
+	return c.String("sub")
+}
+
+// JWTVerifier - admits the clients with a valid JSON Web Token, serve it with
+// server.Use(verifier.Middleware)
+// - HS256/384/512 with an HMAC secret, RS256/384/512 and PS256/384/512 with an
+// RSA key, ES256/384/512 with an ECDSA key. Other algorithms are refused
+// - exp and nbf are checked when present, iss and aud when expected
+// - the claims of an admitted client are found with Channel.Claims
+type JWTVerifier struct {
+	key interface{}
+
+	// Issuer - expected iss claim, any when empty
+	Issuer string
+	// Audience - expected among the aud claim, any when empty
+	Audience string
+	// ClockSkew - tolerance of the exp, nbf and iat checks
+	ClockSkew time.Duration
+	// RequireExpiry - refuse tokens without exp
+	RequireExpiry bool
+	// Now - current time, time.Now when nil
+	Now func() time.Time
+	// Token - finds the token of a client, TokenFromHandshake when nil
+	Token func(c *Channel) string
+}
+
+// NewJWTVerifier - Verifier of the tokens signed with key, a []byte HMAC
+// secret, an *rsa.PublicKey or an *ecdsa.PublicKey. An empty secret is an error
+func NewJWTVerifier(key interface{}) (*JWTVerifier, error) {
+	switch key := key.(type) {
+	case []byte:
+		if len(key) == 0 {
+			return nil, errorEmptySecret
+		}
+		return &JWTVerifier{key: key}, nil
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return &JWTVerifier{key: key}, nil
+	}
+	return nil, fmt.Errorf("Unsupported token key %T", key)
+}
+
+// NewJWTVerifierPEM - Verifier of the tokens signed with the RSA or ECDSA key
+// of the PEM data, see ParsePublicKeyPEM
+func NewJWTVerifierPEM(data []byte) (*JWTVerifier, error) {
+	key, err := ParsePublicKeyPEM(data)
+	if err != nil {
+		return nil, err
+	}
+	return NewJWTVerifier(key)
+}
+
+// ParsePublicKeyPEM - First RSA or ECDSA public key of the PEM data, found in
+// a public key, a certificate or a private key block
+func ParsePublicKeyPEM(data []byte) (crypto.PublicKey, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, errorNoPEMKey
+		}
+
+		var key interface{}
+		var err error
+		switch block.Type {
+		case "PUBLIC KEY":
+			key, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "RSA PUBLIC KEY":
+			key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		case "CERTIFICATE":
+			var cert *x509.Certificate
+			if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+				key = cert.PublicKey
+			}
+		case "RSA PRIVATE KEY":
+			var private *rsa.PrivateKey
+			if private, err = x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+				key = private.Public()
+			}
+		case "EC PRIVATE KEY":
+			var private *ecdsa.PrivateKey
+			if private, err = x509.ParseECPrivateKey(block.Bytes); err == nil {
+				key = private.Public()
+			}
+		case "PRIVATE KEY":
+			var private interface{}
+			if private, err = x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+				if signer, ok := private.(crypto.Signer); ok {
+					key = signer.Public()
+				}
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("PEM %s: %w", block.Type, err)
+		}
+
+		switch key.(type) {
+		case *rsa.PublicKey, *ecdsa.PublicKey:
+			return key, nil
+		}
+	}
+}
+
+// TokenFromHandshake - token field of the auth payload (EIO4), else the bearer
+// Authorization header, else the token query parameter
+func TokenFromHandshake(c *Channel) string {
+	var auth struct {
+		Token string `json:"token"`
+	}
+	if raw := c.Auth(); raw != nil && json.Unmarshal(raw, &auth) == nil && auth.Token != "" {
+		return auth.Token
+	}
+
+	r := c.Request()
+	if r == nil {
+		return ""
+	}
+	if header := r.Header.Get("Authorization"); len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return r.URL.Query().Get("token")
+}
+
+// Middleware - Admit the client when its token is valid, its claims are kept
+// on the channel. Otherwise it is refused with a ConnectError whose data
+// holds the reason
+func (v *JWTVerifier) Middleware(c *Channel, next func(error)) {
+	find := v.Token
+	if find == nil {
+		find = TokenFromHandshake
+	}
+
+	claims, err := v.Verify(find(c))
+	if err != nil {
+		next(&ConnectError{Message: "unauthorized", Data: map[string]string{"error": err.Error()}})
+		return
+	}
+	c.claims = claims
+	next(nil)
+}
+
+// Verify - Claims of the token once its signature and claims are checked
+func (v *JWTVerifier) Verify(token string) (Claims, error) {
+	if token == "" {
+		return nil, errorTokenMissing
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errorTokenMalformed
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeTokenPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errorTokenMalformed
+	}
+	if err := v.verifySignature(header.Alg, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeTokenPart(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if err := v.validate(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+/**
+Check the signature of the signed part (header.payload), the algorithm must
+fit the key
+*/
+func (v *JWTVerifier) verifySignature(alg, signed string, signature []byte) error {
+	if len(alg) != 5 {
+		return fmt.Errorf("Unsupported token algorithm %q", alg)
+	}
+
+	var hash crypto.Hash
+	switch alg[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("Unsupported token algorithm %q", alg)
+	}
+	if alg[:2] == "HS" {
+		secret, ok := v.key.([]byte)
+		if !ok {
+			return fmt.Errorf("Token algorithm %q does not fit the key", alg)
+		}
+		mac := hmac.New(hash.New, secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return errorTokenSignature
+		}
+		return nil
+	}
+
+	digest := hash.New()
+	digest.Write([]byte(signed))
+	sum := digest.Sum(nil)
+
+	switch key := v.key.(type) {
+	case *rsa.PublicKey:
+		var err error
+		switch alg[:2] {
+		case "RS":
+			err = rsa.VerifyPKCS1v15(key, hash, sum, signature)
+		case "PS":
+			err = rsa.VerifyPSS(key, hash, sum, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		default:
+			return fmt.Errorf("Token algorithm %q does not fit the key", alg)
+		}
+		if err != nil {
+			return errorTokenSignature
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		//ES256 is for P-256 keys, ES384 for P-384 and ES512 for P-521
+		bits := map[string]int{"ES256": 256, "ES384": 384, "ES512": 521}[alg]
+		if bits == 0 || key.Curve.Params().BitSize != bits {
+			return fmt.Errorf("Token algorithm %q does not fit the key", alg)
+		}
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errorTokenSignature
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(key, sum, r, s) {
+			return errorTokenSignature
+		}
+		return nil
+	}
+	return fmt.Errorf("Token algorithm %q does not fit the key", alg)
+}
+
+/**
+Check the registered claims, times are given some clock skew
+*/
+func (v *JWTVerifier) validate(claims Claims) error {
+	now := time.Now()
+	if v.Now != nil {
+		now = v.Now()
+	}
+
+	switch exp := claims["exp"].(type) {
+	case float64:
+		if now.After(unixTime(exp).Add(v.ClockSkew)) {
+			return errorTokenExpired
+		}
+	case nil:
+		if v.RequireExpiry {
+			return errorTokenNoExpiry
+		}
+	default:
+		return errorTokenMalformed
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(v.ClockSkew).Before(unixTime(nbf)) {
+		return errorTokenNotYetValid
+	}
+	if iat, ok := claims["iat"].(float64); ok && now.Add(v.ClockSkew).Before(unixTime(iat)) {
+		return errorTokenNotYetValid
+	}
+
+	if v.Issuer != "" && claims.String("iss") != v.Issuer {
+		return errorTokenIssuer
+	}
+	if v.Audience != "" && !hasAudience(claims["aud"], v.Audience) {
+		return errorTokenAudience
+	}
+	return nil
+}
+
+// Claims - Claims of the token the client was admitted with by a
+// JWTVerifier, nil otherwise
+func (c *Channel) Claims() Claims {
+	return c.claims
+}
+
+/**
+Decode a base64url JSON part of a token
+*/
+func decodeTokenPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return errorTokenMalformed
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return errorTokenMalformed
+	}
+	return nil
+}
+
+/**
+The aud claim, a string or an array of them, holds audience
+*/
+func hasAudience(aud interface{}, audience string) bool {
+	switch values := aud.(type) {
+	case string:
+		return values == audience
+	case []interface{}:
+		for _, value := range values {
+			if value == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func unixTime(seconds float64) time.Time {
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
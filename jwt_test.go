@@ -0,0 +1,315 @@
+package gosio
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	testSecret = []byte("s3cret")
+	testRSA    = mustRSAKey()
+	testP256   = mustECKey(elliptic.P256())
+	testP384   = mustECKey(elliptic.P384())
+	testP521   = mustECKey(elliptic.P521())
+)
+
+func mustRSAKey() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func mustECKey(curve elliptic.Curve) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func encodeTokenPart(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+/**
+Token with the given claims signed by key, alg "none" gives an empty signature
+*/
+func signToken(t *testing.T, alg string, key interface{}, claims map[string]interface{}) string {
+	signed := encodeTokenPart(map[string]string{"alg": alg, "typ": "JWT"}) + "." + encodeTokenPart(claims)
+	if alg == "none" {
+		return signed + "."
+	}
+
+	hash := map[string]crypto.Hash{"256": crypto.SHA256, "384": crypto.SHA384, "512": crypto.SHA512}[alg[2:]]
+	digest := hash.New()
+	digest.Write([]byte(signed))
+	sum := digest.Sum(nil)
+
+	var signature []byte
+	var err error
+	switch alg[:2] {
+	case "HS":
+		mac := hmac.New(hash.New, key.([]byte))
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case "RS":
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key.(*rsa.PrivateKey), hash, sum)
+	case "PS":
+		signature, err = rsa.SignPSS(rand.Reader, key.(*rsa.PrivateKey), hash, sum, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	case "ES":
+		private := key.(*ecdsa.PrivateKey)
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, private, sum)
+		if err == nil {
+			size := (private.Curve.Params().BitSize + 7) / 8
+			signature = append(leftPad(r.Bytes(), size), leftPad(s.Bytes(), size)...)
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func leftPad(b []byte, size int) []byte {
+	return append(make([]byte, size-len(b)), b...)
+}
+
+func mustVerifier(t *testing.T, key interface{}) *JWTVerifier {
+	v, err := NewJWTVerifier(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestNewJWTVerifier(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   interface{}
+		valid bool
+	}{
+		{"secret", testSecret, true},
+		{"rsa public key", &testRSA.PublicKey, true},
+		{"ecdsa public key", &testP256.PublicKey, true},
+		{"empty secret", []byte{}, false},
+		{"nil secret", []byte(nil), false},
+		{"string secret", "s3cret", false},
+		{"rsa private key", testRSA, false},
+		{"nil", nil, false},
+	}
+	for _, test := range tests {
+		v, err := NewJWTVerifier(test.key)
+		if test.valid != (err == nil) || test.valid != (v != nil) {
+			t.Errorf("%s: verifier %v, error %v", test.name, v, err)
+		}
+	}
+}
+
+func TestJWTVerifySignature(t *testing.T) {
+	claims := map[string]interface{}{"sub": "u1"}
+	hs := mustVerifier(t, testSecret)
+	rs := mustVerifier(t, &testRSA.PublicKey)
+	es256 := mustVerifier(t, &testP256.PublicKey)
+	es384 := mustVerifier(t, &testP384.PublicKey)
+	es521 := mustVerifier(t, &testP521.PublicKey)
+	publicPEM := encodePEM(t, "PUBLIC KEY", &testRSA.PublicKey)
+
+	tests := []struct {
+		name  string
+		v     *JWTVerifier
+		token string
+		valid bool
+	}{
+		{"HS256", hs, signToken(t, "HS256", testSecret, claims), true},
+		{"HS384", hs, signToken(t, "HS384", testSecret, claims), true},
+		{"HS512", hs, signToken(t, "HS512", testSecret, claims), true},
+		{"RS256", rs, signToken(t, "RS256", testRSA, claims), true},
+		{"RS384", rs, signToken(t, "RS384", testRSA, claims), true},
+		{"RS512", rs, signToken(t, "RS512", testRSA, claims), true},
+		{"PS256", rs, signToken(t, "PS256", testRSA, claims), true},
+		{"PS512", rs, signToken(t, "PS512", testRSA, claims), true},
+		{"ES256", es256, signToken(t, "ES256", testP256, claims), true},
+		{"ES384", es384, signToken(t, "ES384", testP384, claims), true},
+		{"ES512", es521, signToken(t, "ES512", testP521, claims), true},
+
+		{"HS256 other secret", hs, signToken(t, "HS256", []byte("other"), claims), false},
+		{"RS256 other key", rs, signToken(t, "RS256", mustRSAKey(), claims), false},
+		{"PS256 other key", rs, signToken(t, "PS256", mustRSAKey(), claims), false},
+		{"ES256 other key", es256, signToken(t, "ES256", mustECKey(elliptic.P256()), claims), false},
+		{"none", hs, signToken(t, "none", nil, claims), false},
+		{"unknown algorithm", hs, encodeTokenPart(map[string]string{"alg": "HS1"}) + ".e30.", false},
+
+		{"HS256 with the RSA public key as secret", rs, signToken(t, "HS256", publicPEM, claims), false},
+		{"RS256 on a secret", hs, signToken(t, "RS256", testRSA, claims), false},
+		{"RS256 on an ECDSA key", es256, signToken(t, "RS256", testRSA, claims), false},
+		{"ES256 on an RSA key", rs, signToken(t, "ES256", testP256, claims), false},
+		{"ES384 on a P-256 key", es256, signToken(t, "ES384", testP256, claims), false},
+		{"ES256 on a P-384 key", es384, signToken(t, "ES256", testP384, claims), false},
+	}
+	for _, test := range tests {
+		result, err := test.v.Verify(test.token)
+		if test.valid != (err == nil) {
+			t.Errorf("%s: error %v", test.name, err)
+			continue
+		}
+		if test.valid && result.Subject() != "u1" {
+			t.Errorf("%s: subject %q", test.name, result.Subject())
+		}
+	}
+}
+
+func TestJWTVerifyMalformed(t *testing.T) {
+	v := mustVerifier(t, testSecret)
+	parts := strings.Split(signToken(t, "HS256", testSecret, map[string]interface{}{"sub": "u1"}), ".")
+	forged := encodeTokenPart(map[string]string{"sub": "admin"})
+
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"empty", "", errorTokenMissing},
+		{"two parts", parts[0] + "." + parts[1], errorTokenMalformed},
+		{"header not base64", "!." + parts[1] + "." + parts[2], errorTokenMalformed},
+		{"header not JSON", "e30x." + parts[1] + "." + parts[2], errorTokenMalformed},
+		{"signature not base64", parts[0] + "." + parts[1] + ".!", errorTokenMalformed},
+		{"payload forged", parts[0] + "." + forged + "." + parts[2], errorTokenSignature},
+	}
+	for _, test := range tests {
+		if _, err := v.Verify(test.token); err != test.err {
+			t.Errorf("%s: error %v, want %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestJWTValidate(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	at := func(d time.Duration) int64 { return now.Add(d).Unix() }
+
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		setup  func(v *JWTVerifier)
+		err    error
+	}{
+		{"no time claims", map[string]interface{}{}, nil, nil},
+		{"exp ahead", map[string]interface{}{"exp": at(time.Minute)}, nil, nil},
+		{"exp past", map[string]interface{}{"exp": at(-time.Minute)}, nil, errorTokenExpired},
+		{"exp past within skew", map[string]interface{}{"exp": at(-time.Minute)},
+			func(v *JWTVerifier) { v.ClockSkew = 2 * time.Minute }, nil},
+		{"exp past beyond skew", map[string]interface{}{"exp": at(-3 * time.Minute)},
+			func(v *JWTVerifier) { v.ClockSkew = 2 * time.Minute }, errorTokenExpired},
+		{"exp not a number", map[string]interface{}{"exp": "tomorrow"}, nil, errorTokenMalformed},
+		{"exp required", map[string]interface{}{},
+			func(v *JWTVerifier) { v.RequireExpiry = true }, errorTokenNoExpiry},
+		{"exp required and present", map[string]interface{}{"exp": at(time.Minute)},
+			func(v *JWTVerifier) { v.RequireExpiry = true }, nil},
+		{"nbf past", map[string]interface{}{"nbf": at(-time.Minute)}, nil, nil},
+		{"nbf ahead", map[string]interface{}{"nbf": at(time.Minute)}, nil, errorTokenNotYetValid},
+		{"nbf ahead within skew", map[string]interface{}{"nbf": at(time.Minute)},
+			func(v *JWTVerifier) { v.ClockSkew = 2 * time.Minute }, nil},
+		{"iat past", map[string]interface{}{"iat": at(-time.Minute)}, nil, nil},
+		{"iat ahead", map[string]interface{}{"iat": at(time.Minute)}, nil, errorTokenNotYetValid},
+		{"iat ahead within skew", map[string]interface{}{"iat": at(time.Minute)},
+			func(v *JWTVerifier) { v.ClockSkew = 2 * time.Minute }, nil},
+
+		{"iss expected", map[string]interface{}{"iss": "me"},
+			func(v *JWTVerifier) { v.Issuer = "me" }, nil},
+		{"iss other", map[string]interface{}{"iss": "you"},
+			func(v *JWTVerifier) { v.Issuer = "me" }, errorTokenIssuer},
+		{"iss missing", map[string]interface{}{},
+			func(v *JWTVerifier) { v.Issuer = "me" }, errorTokenIssuer},
+		{"iss not expected", map[string]interface{}{"iss": "you"}, nil, nil},
+		{"aud string", map[string]interface{}{"aud": "api"},
+			func(v *JWTVerifier) { v.Audience = "api" }, nil},
+		{"aud array", map[string]interface{}{"aud": []string{"web", "api"}},
+			func(v *JWTVerifier) { v.Audience = "api" }, nil},
+		{"aud other", map[string]interface{}{"aud": []string{"web"}},
+			func(v *JWTVerifier) { v.Audience = "api" }, errorTokenAudience},
+		{"aud missing", map[string]interface{}{},
+			func(v *JWTVerifier) { v.Audience = "api" }, errorTokenAudience},
+	}
+	for _, test := range tests {
+		v := mustVerifier(t, testSecret)
+		v.Now = func() time.Time { return now }
+		if test.setup != nil {
+			test.setup(v)
+		}
+		if _, err := v.Verify(signToken(t, "HS256", testSecret, test.claims)); err != test.err {
+			t.Errorf("%s: error %v, want %v", test.name, err, test.err)
+		}
+	}
+}
+
+func encodePEM(t *testing.T, blockType string, key interface{}) []byte {
+	var der []byte
+	var err error
+	switch blockType {
+	case "PUBLIC KEY":
+		der, err = x509.MarshalPKIXPublicKey(key)
+	case "RSA PUBLIC KEY":
+		der = x509.MarshalPKCS1PublicKey(key.(*rsa.PublicKey))
+	case "RSA PRIVATE KEY":
+		der = x509.MarshalPKCS1PrivateKey(key.(*rsa.PrivateKey))
+	case "EC PRIVATE KEY":
+		der, err = x509.MarshalECPrivateKey(key.(*ecdsa.PrivateKey))
+	case "PRIVATE KEY":
+		der, err = x509.MarshalPKCS8PrivateKey(key)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+}
+
+func TestParsePublicKeyPEM(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		alg  string
+		key  interface{}
+	}{
+		{"PKIX RSA", encodePEM(t, "PUBLIC KEY", &testRSA.PublicKey), "RS256", testRSA},
+		{"PKIX ECDSA", encodePEM(t, "PUBLIC KEY", &testP256.PublicKey), "ES256", testP256},
+		{"PKCS1 public", encodePEM(t, "RSA PUBLIC KEY", &testRSA.PublicKey), "RS256", testRSA},
+		{"PKCS1 private", encodePEM(t, "RSA PRIVATE KEY", testRSA), "PS256", testRSA},
+		{"EC private", encodePEM(t, "EC PRIVATE KEY", testP384), "ES384", testP384},
+		{"PKCS8 private", encodePEM(t, "PRIVATE KEY", testP521), "ES512", testP521},
+		{"after other blocks", append([]byte("junk\n-----BEGIN NOTE-----\n-----END NOTE-----\n"),
+			encodePEM(t, "PUBLIC KEY", &testRSA.PublicKey)...), "RS256", testRSA},
+	}
+	for _, test := range tests {
+		v, err := NewJWTVerifierPEM(test.data)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if _, err := v.Verify(signToken(t, test.alg, test.key, map[string]interface{}{})); err != nil {
+			t.Errorf("%s: %s token refused: %v", test.name, test.alg, err)
+		}
+	}
+
+	if _, err := ParsePublicKeyPEM([]byte("no key here")); err != errorNoPEMKey {
+		t.Errorf("no PEM: error %v", err)
+	}
+	broken := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte("broken")})
+	if _, err := ParsePublicKeyPEM(broken); err == nil {
+		t.Error("broken PEM key accepted")
+	}
+}
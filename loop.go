@@ -3,20 +3,26 @@ package gosio
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gnabgib/go-sio/protocol"
+	"github.com/gnabgib/go-sio/transport"
 	"github.com/golang/glog"
-	"github.com/gorilla/websocket"
 )
 
 const (
 	queueBufferSize = 500
+
+	//out queue marker, the session is closed once the packets before it are written
+	flushMessage = "flush"
 )
 
 var (
-	errorWrongHeader = errors.New("Wrong header")
+	errorWrongHeader      = errors.New("Wrong header")
+	errorUnexpectedBinary = errors.New("Unexpected binary message")
 )
 
 // Header - engine.io header for messages
@@ -25,18 +31,33 @@ type Header struct {
 	Upgrades     []string `json:"upgrades"`
 	PingInterval int      `json:"pingInterval"`
 	PingTimeout  int      `json:"pingTimeout"`
+	MaxPayload   int      `json:"maxPayload"`
+}
+
+/**
+EIO4 namespace CONNECT reply payload
+*/
+type connectReply struct {
+	Sid string `json:"sid"`
 }
 
-func closeChannel(c *Channel, e *event, args ...interface{}) error {
+/**
+Close the session of c for the given reason, err is the underlying error if any
+*/
+func closeChannel(c *Channel, e *event, reason DisconnectReason, err error) error {
 	c.aliveLock.Lock()
-	defer c.aliveLock.Unlock()
 
 	if !c.alive {
 		//already closed
+		c.aliveLock.Unlock()
 		return nil
 	}
 	c.alive = false
-	c.conn.Close()
+	c.closeReason, c.closeErr = reason, err
+	//clients refused by a server were never connected
+	connected := c.server == nil || c.opened
+	c.connection().Close()
+	c.ack.failAll(&DisconnectError{Reason: reason, Err: err})
 
 	// close message in-channel
 	close(c.in)
@@ -47,67 +68,240 @@ func closeChannel(c *Channel, e *event, args ...interface{}) error {
 	}
 	c.out <- protocol.CloseMessage
 
-	e.callLoopEvent(c, OnDisconnection)
+	//handlers may use the channel (e.g. Emit to the offline buffer)
+	c.aliveLock.Unlock()
+
+	e.leaveSockets(c, reason)
+	if connected {
+		e.callLoopEvent(c, OnDisconnection)
+	}
 
 	overfloodedLock.Lock()
 	delete(overflooded, c)
 	overfloodedLock.Unlock()
 
+	close(c.closed)
 	return nil
 }
 
+/**
+Close the session once the packets queued so far are written, unlike
+closeChannel which drops them
+*/
+func closeAfterWrite(c *Channel, e *event, reason DisconnectReason, err error) {
+	c.aliveLock.Lock()
+	if !c.alive {
+		c.aliveLock.Unlock()
+		return
+	}
+	c.pendingReason, c.pendingErr = reason, err
+	c.aliveLock.Unlock()
+
+	c.outLock.Lock()
+	c.out <- flushMessage
+	c.outLock.Unlock()
+}
+
 //incoming messages loop, puts incoming messages to In channel
 func inLoop(c *Channel, e *event) error {
-	glog.V(4).Infoln("Start in loop for channel", c.conn)
+	glog.V(4).Infoln("Start in loop for channel", c.connection())
 	defer func() {
-		glog.V(4).Infoln("Exit in loop for channel", c.conn)
+		glog.V(4).Infoln("Exit in loop for channel", c.connection())
 	}()
+
+	if c.server != nil {
+		//a packet of a remote client must not bring the whole server down
+		defer recoverSession(c, e)
+	}
+
+	//binary packet waiting for its attachments
+	var binary *protocol.Message
+	var received int
+
+	conn := c.connection()
 	for {
-		pkt, err := c.conn.GetMessage()
+		pkt, err := conn.GetMessage()
 
 		if err != nil {
-			if !websocket.IsCloseError(err,websocket.CloseNormalClosure,websocket.CloseGoingAway,websocket.CloseNoStatusReceived) {
+			if next := c.connection(); next != conn {
+				//upgraded, the previous connection has been drained
+				conn = next
+				continue
+			}
+			if !c.IsAlive() {
+				//closed on our side
 				return nil
 			}
 			glog.Errorf("Failed to get message: %s", err)
-			return closeChannel(c, e, err)
+			err = &TransportError{Op: "read", Err: err}
+			e.callError(c, err)
+			return closeChannel(c, e, ReasonTransportError, err)
 		}
-		msg, err := protocol.Decode(pkt)
-		if err != nil {
-			glog.Errorf("Failed to decode message: %s", err)
-			closeChannel(c, e, errors.New("Wrong packet"))
-			return err
+
+		var msg *protocol.Message
+		if strings.HasPrefix(pkt, protocol.BinaryMessage) {
+			if binary == nil {
+				glog.Errorf("Unexpected binary message")
+				e.callError(c, &DecodeError{Source: pkt, Err: errorUnexpectedBinary})
+				continue
+			}
+			binary.Attachments[received] = []byte(pkt[len(protocol.BinaryMessage):])
+			received++
+			if received < len(binary.Attachments) {
+				continue
+			}
+
+			msg, binary = binary, nil
+			msg.Args, err = protocol.ReconstructArgs(msg.Args, msg.Attachments)
+			if err != nil {
+				glog.Errorf("Failed to reconstruct binary message: %s", err)
+				e.callError(c, &DecodeError{Source: msg.Source, Err: err})
+				continue
+			}
+		} else {
+			msg, err = protocol.Decode(pkt)
+			if err != nil {
+				glog.Errorf("Failed to decode message: %s", err)
+				err = &DecodeError{Source: pkt, Err: err}
+				e.callError(c, err)
+				closeChannel(c, e, ReasonParseError, err)
+				return err
+			}
+			if len(msg.Attachments) > 0 {
+				binary, received = msg, 0
+				continue
+			}
 		}
 
 		switch msg.Type {
 		case protocol.MessageTypeOpen:
 			if err := json.Unmarshal([]byte(msg.Source[1:]), &c.header); err != nil {
 				glog.Errorf("Failed to decode message source: %s", err)
-				closeChannel(c, e, errorWrongHeader)
+				err = &DecodeError{Source: msg.Source, Err: errorWrongHeader}
+				e.callError(c, err)
+				return closeChannel(c, e, ReasonParseError, err)
+			}
+			c.setOpened()
+			if upgrader, ok := conn.(transport.Upgrader); ok && len(c.header.Upgrades) > 0 {
+				go upgrade(c, e, upgrader)
+			}
+			if c.version == EIO4 {
+				//the default namespace has to be joined explicitly,
+				//OnConnection is called once the server confirms it
+				go pingWatchdog(c, e, c.header.heartbeatTimeout())
+				connect := &protocol.Message{Type: protocol.MessageTypeConnect}
+				if err := send(connect, c, c.auth); err != nil {
+					glog.Errorf("Failed to send connect: %s", err)
+					return closeChannel(c, e, ReasonTransportError, err)
+				}
+			}
+			e.joinSockets(c)
+			if c.version == EIO4 {
+				break
+			}
+			flushOffline(c)
+			e.callLoopEvent(c, OnConnection)
+		case protocol.MessageTypeConnect:
+			if c.server != nil {
+				c.server.accept(c, msg)
+				break
 			}
+			if msg.Namespace != "" {
+				if s := e.socket(msg.Namespace); s != nil {
+					s.connected(c.session, msg)
+				}
+				break
+			}
+			if c.version != EIO4 {
+				break
+			}
+			var reply connectReply
+			if err := json.Unmarshal([]byte(msg.Args), &reply); err != nil {
+				glog.Errorf("Failed to decode connect reply: %s", err)
+				err = &DecodeError{Source: msg.Source, Err: err}
+				e.callError(c, err)
+				return closeChannel(c, e, ReasonParseError, err)
+			}
+			c.sid = reply.Sid
+			flushOffline(c)
 			e.callLoopEvent(c, OnConnection)
+		case protocol.MessageTypeConnectError:
+			glog.Errorf("Connection refused %s: %s", msg.Namespace, msg.Args)
+			if msg.Namespace != "" {
+				if s := e.socket(msg.Namespace); s != nil {
+					s.leave(c.session, ReasonServerDisconnect)
+				}
+				break
+			}
+			refusal := decodeConnectError(msg.Args)
+			e.callError(c, refusal)
+			return closeChannel(c, e, ReasonServerDisconnect, fmt.Errorf("Connection refused: %w", refusal))
+		case protocol.MessageTypeDisconnect:
+			if msg.Namespace != "" {
+				if s := e.socket(msg.Namespace); s != nil {
+					s.leave(c.session, ReasonServerDisconnect)
+				}
+				break
+			}
+			if c.server != nil {
+				return closeChannel(c, e, ReasonClientDisconnect, nil)
+			}
+			return closeChannel(c, e, ReasonServerDisconnect, nil)
 		case protocol.MessageTypePing:
+			select {
+			case c.heartbeat <- struct{}{}:
+			default:
+			}
 			c.out <- protocol.PongMessage
 		case protocol.MessageTypePong:
+			if c.server != nil {
+				//EIO4 clients answer the pings of the server
+				select {
+				case c.heartbeat <- struct{}{}:
+				default:
+				}
+			}
+		case protocol.MessageTypeNoop:
 		default:
-			glog.V(5).Infof("Received message %d %q", msg.Type, msg.Method)
+			if c.server != nil && !c.isOpened() {
+				//events and acks only once the client is connected to the namespace
+				glog.V(2).Infof("Dropped %q of client %s, not connected", msg.Method, c.header.Sid)
+				break
+			}
+			glog.V(5).Infof("Received message %d %s %q", msg.Type, msg.Namespace, msg.Method)
 			if c.sequentialInLoop {
 				//glog.V(5).Infof("Process %q sequentially", msg.Method)
 				c.in <- msg
-			} else {
+			} else if c.dispatcher != nil {
+				c.dispatcher.dispatch(c, e, msg)
+			} else if ch, h, ok := e.route(c, msg.Namespace); ok {
 				//glog.V(5).Infof("Process %q asynchronously", msg.Method)
-				go e.processIncomingMessage(c, msg)
+				go h.processIncomingMessage(ch, msg)
+			} else {
+				glog.V(5).Info("Unknown namespace ", msg.Namespace)
 			}
 		}
 	}
-	return nil
+}
+
+/**
+Close the server session whose packet could not be handled, instead of
+crashing the server
+*/
+func recoverSession(c *Channel, e *event) {
+	if r := recover(); r != nil {
+		glog.Errorf("Failed to handle a packet of client %s: %v", c.header.Sid, r)
+		err := &DecodeError{Err: fmt.Errorf("%v", r)}
+		e.callError(c, err)
+		closeChannel(c, e, ReasonParseError, err)
+	}
 }
 
 // worker for processing messages
 func workerLoop(c *Channel, e *event) error {
-	glog.V(4).Infoln("Start worker loop for channel", c.conn)
+	glog.V(4).Infoln("Start worker loop for channel", c.connection())
 	defer func() {
-		glog.V(4).Infoln("Exit worker loop for channel", c.conn)
+		glog.V(4).Infoln("Exit worker loop for channel", c.connection())
 	}()
 	for {
 		select {
@@ -115,7 +309,9 @@ func workerLoop(c *Channel, e *event) error {
 			if msg == nil {
 				return nil
 			}
-			e.processIncomingMessage(c, msg)
+			if ch, h, ok := e.route(c, msg.Namespace); ok {
+				h.processIncomingMessage(ch, msg)
+			}
 		}
 	}
 }
@@ -134,15 +330,15 @@ var overfloodedLock sync.Mutex
 outgoing messages loop, sends messages from channel to socket
 */
 func outLoop(c *Channel, e *event) error {
-	glog.V(4).Infoln("Start out loop for channel", c.conn)
+	glog.V(4).Infoln("Start out loop for channel", c.connection())
 	defer func() {
-		glog.V(4).Infoln("Exit out loop for channel", c.conn)
+		glog.V(4).Infoln("Exit out loop for channel", c.connection())
 	}()
 	for {
 		outBufferLen := len(c.out)
 		if outBufferLen >= queueBufferSize-1 {
 			glog.Errorf("Output buffer to small")
-			return closeChannel(c, e, errors.New("Buffer overlow"))
+			return closeChannel(c, e, ReasonBufferOverflow, errorBufferOverlow)
 		} else if outBufferLen > int(queueBufferSize/2) {
 			overfloodedLock.Lock()
 			overflooded[c] = struct{}{}
@@ -157,14 +353,23 @@ func outLoop(c *Channel, e *event) error {
 		if msg == protocol.CloseMessage {
 			return nil
 		}
+		if msg == flushMessage {
+			c.aliveLock.Lock()
+			reason, err := c.pendingReason, c.pendingErr
+			c.aliveLock.Unlock()
+			return closeChannel(c, e, reason, err)
+		}
 
+		c.connLock.RLock()
 		err := c.conn.WriteMessage(msg)
+		c.connLock.RUnlock()
 		if err != nil {
 			glog.Errorf("Failed to write message: %s", err)
-			return closeChannel(c, e, err)
+			err = &TransportError{Op: "write", Packet: msg, Err: err}
+			e.callError(c, err)
+			return closeChannel(c, e, ReasonTransportError, err)
 		}
 	}
-	return nil
 }
 
 /**
@@ -172,7 +377,7 @@ Pinger sends ping messages for keeping connection alive
 */
 func pinger(c *Channel) {
 	for {
-		interval, _ := c.conn.PingParams()
+		interval, _ := c.connection().PingParams()
 		time.Sleep(interval)
 		if !c.IsAlive() {
 			return
@@ -181,3 +386,35 @@ func pinger(c *Channel) {
 		c.out <- protocol.PingMessage
 	}
 }
+
+/**
+Time allowed between two server pings (EIO4), as announced in the handshake
+*/
+func (h *Header) heartbeatTimeout() time.Duration {
+	return time.Duration(h.PingInterval+h.PingTimeout) * time.Millisecond
+}
+
+/**
+With EIO4 the server sends pings and the client answers them, the watchdog
+closes the channel when no ping arrives in time
+*/
+func pingWatchdog(c *Channel, e *event, timeout time.Duration) {
+	if timeout <= 0 {
+		interval, pingTimeout := c.connection().PingParams()
+		timeout = interval + pingTimeout
+	}
+	for {
+		select {
+		case <-c.heartbeat:
+			if !c.IsAlive() {
+				return
+			}
+		case <-time.After(timeout):
+			if c.IsAlive() {
+				glog.Errorf("No ping received in %s", timeout)
+				closeChannel(c, e, ReasonPingTimeout, nil)
+			}
+			return
+		}
+	}
+}
@@ -22,56 +22,228 @@ const (
 Contains maps of message processing functions
 */
 type event struct {
-	messageHandlers     map[string]*caller
+	messageHandlers     map[string][]*listener
 	messageHandlersLock sync.RWMutex
+	lastHandle          Handle
+	patterns            []*pattern
+	ackErrors           func() AckErrorFormat
 
 	onConnection    systemHandler
-	onDisconnection systemHandler
+	onDisconnection disconnectHandler
+	onError         errorHandler
+
+	anyHandlers         []anyHandler
+	anyOutgoingHandlers []anyHandler
+
+	sockets     map[string]*Socket
+	socketsLock sync.Mutex
 }
 
 /**
-create messageHandlers map
+create messageHandlers and sockets maps
 */
 func (e *event) initMethods() {
-	e.messageHandlers = make(map[string]*caller)
+	e.messageHandlers = make(map[string][]*listener)
+	e.sockets = make(map[string]*Socket)
 }
 
+// Handle - identifies a handler added with On or Once, to remove it with Off
+type Handle uint64
+
 /**
-Add message processing function, and bind it to given method
+Message processing function bound to a method
 */
-func (e *event) On(method string, f interface{}) error {
+type listener struct {
+	handle Handle
+	caller *caller
+	once   bool
+}
+
+// On - Add message processing function for the given method, called after
+// the ones added before
+func (e *event) On(method string, f interface{}) (Handle, error) {
 	glog.V(5).Info("Listening to ",method)
+	return e.addListener(method, f, false)
+}
+
+// Once - Like On, the function is removed after its first call
+func (e *event) Once(method string, f interface{}) (Handle, error) {
+	glog.V(5).Info("Listening once to ",method)
+	return e.addListener(method, f, true)
+}
+
+// Off - Remove the message processing function with the given handle,
+// method is the event name, ignored for handlers added with a pattern
+func (e *event) Off(method string, h Handle) {
+	e.messageHandlersLock.Lock()
+	defer e.messageHandlersLock.Unlock()
+
+	e.removeListener(method, h)
+}
+
+// OffAll - Remove every message processing function of the method, see
+// OffPattern and OffRegexp for the patterns
+func (e *event) OffAll(method string) {
+	e.messageHandlersLock.Lock()
+	delete(e.messageHandlers, method)
+	e.messageHandlersLock.Unlock()
+}
+
+func (e *event) addListener(method string, f interface{}, once bool) (Handle, error) {
 	c, err := newCaller(f)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	e.messageHandlersLock.Lock()
-	e.messageHandlers[method] = c
-	e.messageHandlersLock.Unlock()
+	defer e.messageHandlersLock.Unlock()
+
+	e.lastHandle++
+	l := &listener{handle: e.lastHandle, caller: c, once: once}
+	e.messageHandlers[method] = append(e.messageHandlers[method], l)
+	return l.handle, nil
+}
+
+/**
+Remove a listener of the method or of a pattern, the lock has to be held
+*/
+func (e *event) removeListener(method string, h Handle) bool {
+	rest, ok := withoutListener(e.messageHandlers[method], h)
+	if !ok {
+		return e.removePatternListener(h)
+	}
+	if len(rest) == 0 {
+		delete(e.messageHandlers, method)
+	} else {
+		e.messageHandlers[method] = rest
+	}
+	return true
+}
+
+/**
+Copy of listeners without the one with the given handle, copied so
+snapshots returned by findMethod and resolve stay untouched
+*/
+func withoutListener(listeners []*listener, h Handle) ([]*listener, bool) {
+	for i, l := range listeners {
+		if l.handle != h {
+			continue
+		}
+		rest := make([]*listener, 0, len(listeners)-1)
+		rest = append(rest, listeners[:i]...)
+		return append(rest, listeners[i+1:]...), true
+	}
+	return nil, false
+}
+
+/**
+Whether the listener may be called, a once listener only by the first caller
+*/
+func (e *event) claim(method string, l *listener) bool {
+	if !l.once {
+		return true
+	}
+
+	e.messageHandlersLock.Lock()
+	defer e.messageHandlersLock.Unlock()
 
-	return nil
+	return e.removeListener(method, l.handle)
 }
 func (e *event) OnConnect(f systemHandler)  {
 	e.messageHandlersLock.Lock()
 	e.onConnection=f
 	e.messageHandlersLock.Unlock()
 }
+
+// OnDisconnect - f is called once the channel is closed, see OnDisconnectReason
 func (e *event) OnDisconnect(f systemHandler) {
+	var h disconnectHandler
+	if f != nil {
+		h = func(c *Channel, reason DisconnectReason) { f(c) }
+	}
+	e.OnDisconnectReason(h)
+}
+
+// OnDisconnectReason - f is called once the channel is closed, with the reason,
+// it replaces the handler set by OnDisconnect and the other way round
+func (e *event) OnDisconnectReason(f disconnectHandler) {
 	e.messageHandlersLock.Lock()
 	e.onDisconnection=f
 	e.messageHandlersLock.Unlock()
 }
 
+// OnError - f receives decoding and transport failures (*DecodeError,
+// *TransportError), events whose arguments do not fit their handler (*HandlerArgError)
+// and the refusal of a server (*ConnectError)
+func (e *event) OnError(f func(c *Channel, err error)) {
+	e.messageHandlersLock.Lock()
+	e.onError = f
+	e.messageHandlersLock.Unlock()
+}
+
+// OnAny - add a handler receiving every incoming event (args is the JSON array
+// of its arguments), called before the handler of the event if there is one
+func (e *event) OnAny(f func(c *Channel, event string, args json.RawMessage)) {
+	e.messageHandlersLock.Lock()
+	e.anyHandlers = append(e.anyHandlers, f)
+	e.messageHandlersLock.Unlock()
+}
+
+// OnAnyOutgoing - add a handler receiving every event sent with Emit or Ack
+func (e *event) OnAnyOutgoing(f func(c *Channel, event string, args json.RawMessage)) {
+	e.messageHandlersLock.Lock()
+	e.anyOutgoingHandlers = append(e.anyOutgoingHandlers, f)
+	e.messageHandlersLock.Unlock()
+}
+
+func (e *event) callAny(c *Channel, msg *protocol.Message) {
+	e.messageHandlersLock.RLock()
+	handlers := e.anyHandlers
+	e.messageHandlersLock.RUnlock()
+
+	callAnyHandlers(handlers, c, msg)
+}
+
+func (e *event) callAnyOutgoing(c *Channel, msg *protocol.Message) {
+	e.messageHandlersLock.RLock()
+	handlers := e.anyOutgoingHandlers
+	e.messageHandlersLock.RUnlock()
+
+	callAnyHandlers(handlers, c, msg)
+}
+
+func callAnyHandlers(handlers []anyHandler, c *Channel, msg *protocol.Message) {
+	if len(handlers) == 0 {
+		return
+	}
+	args := json.RawMessage("[" + msg.Args + "]")
+	for _, f := range handlers {
+		f(c, msg.Method, args)
+	}
+}
+
 /**
-Find message processing function associated with given method
+Pass err to the OnError handler, if any
 */
-func (e *event) findMethod(method string) (*caller, bool) {
+func (e *event) callError(c *Channel, err error) {
+	e.messageHandlersLock.RLock()
+	f := e.onError
+	e.messageHandlersLock.RUnlock()
+
+	if f != nil {
+		f(c, err)
+	}
+}
+
+/**
+Find message processing functions associated with given method, in order
+*/
+func (e *event) findMethod(method string) ([]*listener, bool) {
 	e.messageHandlersLock.RLock()
 	defer e.messageHandlersLock.RUnlock()
 
-	f, ok := e.messageHandlers[method]
-	return f, ok
+	listeners, ok := e.messageHandlers[method]
+	return listeners, ok
 }
 
 func (e *event) callLoopEvent(c *Channel, event string) {
@@ -82,18 +254,41 @@ func (e *event) callLoopEvent(c *Channel, event string) {
 		return
 	}
 	if event == OnDisconnection {
-		if e.onDisconnection != nil {
-			e.onDisconnection(c)
+		e.messageHandlersLock.RLock()
+		f := e.onDisconnection
+		e.messageHandlersLock.RUnlock()
+		if f != nil {
+			f(c, c.DisconnectReason())
 		}
 		return
 	}
 
-	f, ok := e.findMethod(event)
-	if !ok {
-		return
+	listeners, _ := e.findMethod(event)
+	for _, l := range listeners {
+		if !e.claim(event, l) {
+			continue
+		}
+		//loop events carry no arguments
+		args, _ := l.caller.decodeArgs("")
+		l.caller.callFunc(c, Route{Event: event}, args, nil)
+	}
+}
+
+/**
+Call a listener with the arguments of msg, false when they do not fit
+its parameters. reply answers the ack request, nil for an emit
+*/
+func (e *event) callListener(c *Channel, msg *protocol.Message, l *listener, route Route,
+	reply func(interface{})) ([]reflect.Value, bool) {
+	f := l.caller
+	args, err := f.decodeArgs(msg.Args)
+	if err != nil {
+		glog.V(5).Info(msg.Method,"Unable to decode reply",err)
+		e.callError(c, &HandlerArgError{Method: msg.Method, Source: msg.Source, Err: err})
+		return nil, false
 	}
 
-	f.callFunc(c, &struct{}{})
+	return f.callFunc(c, route, args, reply), true
 }
 
 /**
@@ -106,59 +301,42 @@ func (e *event) processIncomingMessage(c *Channel, msg *protocol.Message) {
 	switch msg.Type {
 	case protocol.MessageTypeEmit:
 		glog.V(5).Info("got-emit:",msg.Method,"(",msg.Args,")")
-		f, ok := e.findMethod(msg.Method)
-		if !ok {
+		e.callAny(c, msg)
+		key, listeners, route := e.resolve(msg.Method)
+		if len(listeners) == 0 {
 			glog.V(5).Info("Couldn't find message for ",msg.Method)
 			return
 		}
 
-		if !f.ArgsPresent {
-			f.callFunc(c, &struct{}{})
-			return
-		}
-
-		data := f.getArgs()
-		
-		err := json.Unmarshal([]byte(msg.Args), &data)
-		if err != nil {
-			glog.V(5).Info(msg.Method,"Unable to decode reply",err)
-			return		
+		for _, l := range listeners {
+			if e.claim(key, l) {
+				e.callListener(c, msg, l, route, nil)
+			}
 		}
 
-		f.callFunc(c, data)
-
 	case protocol.MessageTypeAckRequest:
 		glog.V(5).Info("got-ack:",msg.Method,"(",msg.Args,")")
-		f, ok := e.findMethod(msg.Method)
-		if !ok || !f.Out {
-			return
-		}
+		e.callAny(c, msg)
+		key, listeners, route := e.resolve(msg.Method)
 
-		var result []reflect.Value
-		if f.ArgsPresent {
-			//data type should be defined for unmarshall
-			data := f.getArgs()
-			err := json.Unmarshal([]byte(msg.Args), &data)
-			if err != nil {
-				return
+		//every listener is called, the first to return a value or
+		//call its AckFunc answers
+		reply := ackReplier(c, msg)
+		for _, l := range listeners {
+			if !e.claim(key, l) {
+				continue
+			}
+			result, ok := e.callListener(c, msg, l, route, reply)
+			if ok && (l.caller.Out || l.caller.ErrOut) {
+				reply(l.caller.ackResponse(result, e.ackErrorFormat()))
 			}
-
-			result = f.callFunc(c, data)
-		} else {
-			result = f.callFunc(c, &struct{}{})
-		}
-
-		ack := &protocol.Message{
-			Type:  protocol.MessageTypeAckResponse,
-			AckID: msg.AckID,
 		}
-		send(ack, c, result[0].Interface())
 
 	case protocol.MessageTypeAckResponse:
 		glog.V(5).Info("got-ack-response:",msg.AckID)
 		waiter, err := c.ack.getWaiter(msg.AckID)
 		if err == nil {
-			waiter <- msg.Args
+			waiter.complete(msg.Args, nil)
 		}
 	}
 }
@@ -0,0 +1,173 @@
+package gosio
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gnabgib/go-sio/transport"
+	"github.com/gorilla/websocket"
+)
+
+func TestOnAnyOutgoingEmits(t *testing.T) {
+	got := make(chan string, 10)
+	srv, u := fakeServer(t, func(ws *websocket.Conn, r *http.Request) {
+		writePacket(ws, `0{"sid":"eng","upgrades":[],"pingInterval":20000,"pingTimeout":2000}`)
+		writePacket(ws, "40")
+		for i := 0; i < 4; i++ {
+			got <- readPacket(ws, 2*time.Second)
+		}
+	})
+	defer srv.Close()
+
+	c := New(u, transport.GetDefaultWebsocketTransport())
+	//a forwarding listener, it emits from within the outgoing notification
+	c.OnAnyOutgoing(func(ch *Channel, method string, args json.RawMessage) {
+		if method != "audit" {
+			c.Emit("audit", method)
+		}
+	})
+
+	//buffered while connecting, flushed once connected
+	if err := c.Emit("early"); err != nil {
+		t.Fatal(err)
+	}
+	connected := make(chan bool, 1)
+	c.OnConnect(func(ch *Channel) { connected <- true })
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	select {
+	case <-connected:
+	case <-time.After(2 * time.Second):
+		t.Fatal("not connected")
+	}
+	done := make(chan error, 1)
+	go func() { done <- c.Emit("late") }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Emit from an outgoing listener deadlocked")
+	}
+
+	want := []string{`42["early"]`, `42["audit","early"]`, `42["late"]`, `42["audit","late"]`}
+	for _, w := range want {
+		if p := <-got; p != w {
+			t.Fatalf("got %q, want %q", p, w)
+		}
+	}
+}
+
+func TestListenerHandles(t *testing.T) {
+	e := newTestEvent()
+	handler := func(c *Channel) {}
+	first, _ := e.On("a", handler)
+	once, _ := e.Once("a", handler)
+	last, _ := e.On("a", handler)
+	other, _ := e.On("b", handler)
+	if first == once || once == last || last == other {
+		t.Fatalf("handles not unique: %d %d %d %d", first, once, last, other)
+	}
+
+	listeners, _ := e.findMethod("a")
+	if got := handles(listeners); !reflect.DeepEqual(got, []Handle{first, once, last}) {
+		t.Fatalf("listeners %v, want them in the order added", got)
+	}
+
+	//concurrent messages, the once listener is called by one of them only
+	var claimed int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if e.claim("a", listeners[1]) {
+				atomic.AddInt32(&claimed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if claimed != 1 {
+		t.Fatalf("once listener claimed %d times", claimed)
+	}
+	if got, _ := e.findMethod("a"); !reflect.DeepEqual(handles(got), []Handle{first, last}) {
+		t.Fatalf("listeners %v once claimed", handles(got))
+	}
+
+	//an unknown handle or one of another method is left alone
+	e.Off("a", Handle(1000))
+	e.Off("a", other)
+	e.Off("a", first)
+	if got, _ := e.findMethod("a"); !reflect.DeepEqual(handles(got), []Handle{last}) {
+		t.Fatalf("listeners %v after Off", handles(got))
+	}
+	if got, _ := e.findMethod("b"); !reflect.DeepEqual(handles(got), []Handle{other}) {
+		t.Fatalf("Off of a removed %v", handles(got))
+	}
+
+	pattern, _ := e.OnPattern("b*", handler)
+	e.OffAll("b")
+	if _, ok := e.findMethod("b"); ok {
+		t.Fatal("OffAll left listeners")
+	}
+	if _, listeners, _ := e.resolve("b"); !reflect.DeepEqual(handles(listeners), []Handle{pattern}) {
+		t.Fatalf("OffAll removed the pattern, %v left", handles(listeners))
+	}
+	//the method is ignored for a pattern listener
+	e.Off("anything", pattern)
+	if _, listeners, _ := e.resolve("b"); len(listeners) != 0 {
+		t.Fatalf("Off of a pattern listener left %v", handles(listeners))
+	}
+
+	oncePattern, _ := e.OnPattern("c*", handler)
+	_, listeners, _ = e.resolve("cd")
+	if len(listeners) != 1 || listeners[0].handle != oncePattern || !e.claim("cd", listeners[0]) {
+		t.Fatal("pattern listener not claimed")
+	}
+}
+
+func TestOnceHandledOnce(t *testing.T) {
+	const n = 10
+	srv, u := fakeServer(t, func(ws *websocket.Conn, r *http.Request) {
+		writePacket(ws, testHandshake)
+		writePacket(ws, "40")
+		for i := 0; i < n; i++ {
+			writePacket(ws, fmt.Sprintf(`42["tick",%d]`, i))
+		}
+		readPacket(ws, 2*time.Second)
+	})
+	defer srv.Close()
+
+	c := New(u, transport.GetDefaultWebsocketTransport())
+	//handlers run concurrently
+	c.Workers = 4
+	var once int32
+	ticks := make(chan int, n)
+	c.Once("tick", func(ch *Channel, i int) { atomic.AddInt32(&once, 1) })
+	c.On("tick", func(ch *Channel, i int) { ticks <- i })
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for i := 0; i < n; i++ {
+		select {
+		case <-ticks:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%d ticks handled, want %d", i, n)
+		}
+	}
+	if got := atomic.LoadInt32(&once); got != 1 {
+		t.Fatalf("Once handler called %d times", got)
+	}
+}
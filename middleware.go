@@ -0,0 +1,115 @@
+package gosio
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/gnabgib/go-sio/protocol"
+	"github.com/golang/glog"
+)
+
+// Middleware - Runs before a client is admitted, with its handshake request
+// (Channel.Request) and EIO4 auth payload (Channel.Auth)
+// - next(nil) passes the client to the next middleware, the last one admits it
+// - next(err) refuses it with a CONNECT_ERROR, a *ConnectError carries its data
+// - next may be called later from another goroutine, the client waits until then.
+// A client gone meanwhile is neither admitted nor refused
+type Middleware func(c *Channel, next func(error))
+
+// ConnectError - Why a client was refused, Data is sent along with Message.
+// Clients get it back from the error of their closed channel (errors.As)
+type ConnectError struct {
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *ConnectError) Error() string {
+	return e.Message
+}
+
+// Use - Add a middleware, they run in the order they were added
+func (s *Server) Use(m Middleware) {
+	s.middlewaresLock.Lock()
+	s.middlewares = append(s.middlewares, m)
+	s.middlewaresLock.Unlock()
+}
+
+/**
+Run the middlewares on c, done gets nil once every one of them let it through
+or the error of the first one refusing it
+*/
+func (s *Server) admit(c *Channel, done func(error)) {
+	s.middlewaresLock.RLock()
+	chain := s.middlewares
+	s.middlewaresLock.RUnlock()
+
+	var run func(i int)
+	run = func(i int) {
+		if i == len(chain) {
+			done(nil)
+			return
+		}
+		var once sync.Once
+		chain[i](c, func(err error) {
+			once.Do(func() {
+				if err != nil {
+					done(err)
+					return
+				}
+				run(i + 1)
+			})
+		})
+	}
+	run(0)
+}
+
+/**
+Tell the client why it is refused, then close its session
+*/
+func (s *Server) reject(c *Channel, err error) {
+	glog.V(2).Infof("Client %s refused: %s", c.header.Sid, err)
+
+	refusal, ok := err.(*ConnectError)
+	if !ok {
+		refusal = &ConnectError{Message: err.Error()}
+	}
+	if err := send(&protocol.Message{Type: protocol.MessageTypeConnectError}, c, connectErrorPayload(c.version, refusal)); err != nil {
+		closeChannel(c, &s.event, ReasonTransportError, err)
+		return
+	}
+	closeAfterWrite(c, &s.event, ReasonServerDisconnect, refusal)
+}
+
+/**
+CONNECT_ERROR payload, EIO3 clients get the data alone (or the message when
+there is none), EIO4 ones an object with both
+*/
+func connectErrorPayload(version ProtocolVersion, e *ConnectError) interface{} {
+	if version == EIO4 {
+		return e
+	}
+	if e.Data != nil {
+		return e.Data
+	}
+	return e.Message
+}
+
+/**
+Refusal received by a client, whatever the protocol version of the server
+*/
+func decodeConnectError(args string) *ConnectError {
+	var refusal ConnectError
+	if err := json.Unmarshal([]byte(args), &refusal); err == nil && refusal.Message != "" {
+		return &refusal
+	}
+	var message string
+	if err := json.Unmarshal([]byte(args), &message); err == nil {
+		return &ConnectError{Message: message}
+	}
+
+	var data interface{}
+	if err := json.Unmarshal([]byte(args), &data); err != nil {
+		return &ConnectError{Message: args}
+	}
+	return &ConnectError{Message: args, Data: data}
+}
@@ -0,0 +1,245 @@
+package gosio
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func refusingServer(t *testing.T) (*Server, func(), string, chan string) {
+	s, hs, endpoint := testServer(t)
+	s.Use(func(c *Channel, next func(error)) {
+		next(&ConnectError{Message: "unauthorized", Data: map[string]string{"code": "E1"}})
+	})
+	called := make(chan string, 4)
+	s.On("secret", func(c *Channel, arg string) string {
+		called <- arg
+		return "leaked"
+	})
+	s.OnConnect(func(c *Channel) { called <- "connect" })
+	return s, func() { s.Close(); hs.Close() }, endpoint, called
+}
+
+/**
+Packets read until the server closes the connection
+*/
+func readUntilClosed(read func() string) []string {
+	var packets []string
+	for p := read(); p != ""; p = read() {
+		packets = append(packets, p)
+	}
+	return packets
+}
+
+func TestMiddlewareRefusesEIO4(t *testing.T) {
+	_, stop, endpoint, called := refusingServer(t)
+	defer stop()
+
+	ws := dialRaw(t, endpoint, "EIO=4")
+	defer ws.Close()
+	writePacket(ws, `40{"token":"x"}`)
+	writePacket(ws, `421["secret","after refusal"]`)
+
+	packets := readUntilClosed(func() string { return readSkippingPings(ws, 2*time.Second) })
+	if len(packets) != 1 || packets[0] != `44{"message":"unauthorized","data":{"code":"E1"}}` {
+		t.Fatalf("packets %q", packets)
+	}
+	select {
+	case arg := <-called:
+		t.Fatalf("refused client reached the handlers: %q", arg)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestMiddlewareRefusesEIO3(t *testing.T) {
+	_, stop, endpoint, called := refusingServer(t)
+	defer stop()
+
+	ws := dialRaw(t, endpoint, "EIO=3")
+	defer ws.Close()
+	//sent while the refusal is being written
+	writePacket(ws, `421["secret","after refusal"]`)
+	writePacket(ws, `42["secret","after refusal"]`)
+
+	packets := readUntilClosed(func() string { return readPacket(ws, 2*time.Second) })
+	if len(packets) != 1 || packets[0] != `44{"code":"E1"}` {
+		t.Fatalf("packets %q", packets)
+	}
+	select {
+	case arg := <-called:
+		t.Fatalf("refused client reached the handlers: %q", arg)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestMiddlewareSkippedConnect(t *testing.T) {
+	s, stop, endpoint, called := refusingServer(t)
+	defer stop()
+	ran := make(chan bool, 1)
+	s.Use(func(c *Channel, next func(error)) { ran <- true })
+
+	ws := dialRaw(t, endpoint, "EIO=4")
+	defer ws.Close()
+	writePacket(ws, `421["secret","without connect"]`)
+	writePacket(ws, `42["secret","without connect"]`)
+
+	select {
+	case arg := <-called:
+		t.Fatalf("client reached the handlers without connecting: %q", arg)
+	case <-ran:
+		t.Fatal("middleware ran without connect")
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestMiddlewarePending(t *testing.T) {
+	s, hs, endpoint := testServer(t)
+	defer hs.Close()
+	defer s.Close()
+
+	release := make(chan func(error), 1)
+	s.Use(func(c *Channel, next func(error)) {
+		if c.Request().Header.Get("User-Agent") == "" || string(c.Auth()) != `{"token":"x"}` {
+			next(errors.New("no handshake"))
+			return
+		}
+		release <- next
+	})
+	called := make(chan string, 4)
+	s.On("echo", func(c *Channel, arg string) string {
+		called <- arg
+		return arg
+	})
+
+	ws := dialRaw(t, endpoint, "EIO=4")
+	defer ws.Close()
+	writePacket(ws, `40{"token":"x"}`)
+	next := <-release
+	writePacket(ws, `421["echo","while admitting"]`)
+	time.Sleep(100 * time.Millisecond)
+
+	//admitted later, from another goroutine
+	go next(nil)
+	if p := readSkippingPings(ws, time.Second); !strings.HasPrefix(p, "40") {
+		t.Fatalf("connect reply %q", p)
+	}
+	writePacket(ws, `422["echo","admitted"]`)
+	if p := readSkippingPings(ws, time.Second); p != `432["admitted"]` {
+		t.Fatalf("ack %q", p)
+	}
+	if arg := <-called; arg != "admitted" {
+		t.Fatalf("handler called with %q", arg)
+	}
+}
+
+func TestDecodeConnectError(t *testing.T) {
+	tests := []struct {
+		args    string
+		message string
+		data    string
+	}{
+		{`{"message":"unauthorized","data":{"code":"E1"}}`, "unauthorized", `{"code":"E1"}`},
+		{`{"message":"Invalid namespace"}`, "Invalid namespace", "null"},
+		{`"Not authorized"`, "Not authorized", "null"},
+		{`{"code":"E1"}`, `{"code":"E1"}`, `{"code":"E1"}`},
+		{`not json`, "not json", "null"},
+	}
+	for _, test := range tests {
+		refusal := decodeConnectError(test.args)
+		data, _ := json.Marshal(refusal.Data)
+		if refusal.Message != test.message || string(data) != test.data {
+			t.Errorf("decodeConnectError(%s) = %q %s", test.args, refusal.Message, data)
+		}
+	}
+}
+
+func TestMiddlewareAdmitsGoneClient(t *testing.T) {
+	s, hs, endpoint := testServer(t)
+	defer hs.Close()
+	defer s.Close()
+
+	type pending struct {
+		c    *Channel
+		next func(error)
+	}
+	release := make(chan pending, 1)
+	s.Use(func(c *Channel, next func(error)) { release <- pending{c, next} })
+	connected := make(chan bool, 1)
+	s.OnConnect(func(c *Channel) { connected <- true })
+	rejoined := make(chan []string, 1)
+	s.OnDisconnect(func(c *Channel) {
+		//handlers running after close cannot add rooms again
+		c.Join("late")
+		rejoined <- c.Rooms()
+	})
+
+	ws := dialRaw(t, endpoint, "EIO=4")
+	writePacket(ws, "40")
+	p := <-release
+	ws.Close()
+	for deadline := time.Now().Add(time.Second); p.c.IsAlive() || s.Channel(p.c.ID()) != nil; {
+		if time.Now().After(deadline) {
+			t.Fatal("client not removed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	p.next(nil)
+	select {
+	case <-connected:
+		t.Fatal("OnConnect called for a gone client")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if sockets, err := s.Except().FetchSockets(); err != nil || len(sockets) != 0 {
+		t.Fatalf("sockets %v %v", sockets, err)
+	}
+	if rooms := p.c.Rooms(); len(rooms) != 0 {
+		t.Fatalf("rooms of the gone client %v", rooms)
+	}
+	select {
+	case rooms := <-rejoined:
+		t.Fatalf("OnDisconnect called for a client never connected, rooms %v", rooms)
+	default:
+	}
+}
+
+func TestJoinAfterClose(t *testing.T) {
+	s, hs, endpoint := testServer(t)
+	defer hs.Close()
+	defer s.Close()
+
+	rooms := make(chan []string, 1)
+	s.OnDisconnect(func(c *Channel) {
+		c.Join("late")
+		rooms <- c.Rooms()
+	})
+	ws := dialRaw(t, endpoint, "EIO=4")
+	writePacket(ws, "40")
+	if p := readSkippingPings(ws, time.Second); !strings.HasPrefix(p, "40") {
+		t.Fatalf("connect reply %q", p)
+	}
+	ws.Close()
+	select {
+	case r := <-rooms:
+		//its own room is left once the handlers ran
+		for _, room := range r {
+			if room == "late" {
+				t.Fatalf("closed client joined %v", r)
+			}
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnDisconnect not called")
+	}
+	//the client leaves its rooms once it is removed
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(10 * time.Millisecond) {
+		sockets, err := s.Except().FetchSockets()
+		if err == nil && len(sockets) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("sockets %v %v", sockets, err)
+		}
+	}
+}
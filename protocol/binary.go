@@ -0,0 +1,281 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var (
+	errorWrongAttachment = errors.New("Wrong binary attachment")
+
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+	//types already checked by containsBinary
+	binaryTypes sync.Map
+)
+
+/*
+*
+Placeholder sent in the JSON payload instead of a binary attachment
+*/
+type placeholder struct {
+	Placeholder bool `json:"_placeholder"`
+	Num         int  `json:"num"`
+}
+
+// DeconstructArgs - Replace every []byte found in args by a placeholder,
+// returns the JSON-ready args and the attachments in placeholder order
+func DeconstructArgs(args interface{}) (interface{}, [][]byte) {
+	var attachments [][]byte
+	result := deconstruct(reflect.ValueOf(args), &attachments)
+	if len(attachments) == 0 {
+		return args, nil
+	}
+	return result, attachments
+}
+
+// ReconstructArgs - Put the attachments back in place of their placeholders,
+// attachments are inlined as base64 strings, so they unmarshal into []byte
+func ReconstructArgs(args string, attachments [][]byte) (string, error) {
+	decoder := json.NewDecoder(strings.NewReader("[" + args + "]"))
+	decoder.UseNumber()
+
+	var data interface{}
+	if err := decoder.Decode(&data); err != nil {
+		return "", err
+	}
+
+	data, err := reconstruct(data, attachments)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(data); err != nil {
+		return "", err
+	}
+
+	//drop the surrounding brackets and the trailing newline of the encoder
+	result := strings.TrimSpace(buf.String())
+	return result[1 : len(result)-1], nil
+}
+
+func deconstruct(v reflect.Value, attachments *[][]byte) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	if !containsBinary(v.Type()) {
+		return v.Interface()
+	}
+
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return deconstruct(v.Elem(), attachments)
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			*attachments = append(*attachments, v.Bytes())
+			return &placeholder{Placeholder: true, Num: len(*attachments) - 1}
+		}
+		fallthrough
+	case reflect.Array:
+		result := make([]interface{}, v.Len())
+		for i := range result {
+			result[i] = deconstruct(v.Index(i), attachments)
+		}
+		return result
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		result := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			result[mapKey(iter.Key())] = deconstruct(iter.Value(), attachments)
+		}
+		return result
+	case reflect.Struct:
+		return deconstructStruct(v, attachments)
+	}
+	return v.Interface()
+}
+
+/*
+*
+Structs are marshalled as usual, then the fields holding binary data are
+replaced, following encoding/json naming (json tag, promoted embedded fields)
+*/
+func deconstructStruct(v reflect.Value, attachments *[][]byte) interface{} {
+	raw, err := json.Marshal(v.Interface())
+	if err != nil {
+		//let the caller report the error when marshalling again
+		return v.Interface()
+	}
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return v.Interface()
+	}
+
+	result := make(map[string]interface{}, len(fields))
+	for name, value := range fields {
+		result[name] = value
+	}
+	replaceFields(v, result, make(map[string]bool), attachments)
+	return result
+}
+
+/*
+*
+Replace the binary fields of v present in result, names claimed by a
+shallower field are left untouched
+*/
+func replaceFields(v reflect.Value, result map[string]interface{}, claimed map[string]bool,
+	attachments *[][]byte) {
+	t := v.Type()
+	var embedded []reflect.Value
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := tag
+		if pos := strings.IndexByte(tag, ','); pos != -1 {
+			name = tag[:pos]
+		}
+
+		value := v.Field(i)
+		if field.Anonymous && name == "" {
+			if value.Kind() == reflect.Ptr && !value.IsNil() {
+				value = value.Elem()
+			}
+			if value.Kind() == reflect.Struct {
+				//unexported embedded structs keep their marshalled form
+				if field.PkgPath == "" {
+					embedded = append(embedded, value)
+				}
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if claimed[name] {
+			continue
+		}
+		claimed[name] = true
+		if _, ok := result[name]; ok && containsBinary(field.Type) {
+			result[name] = deconstruct(value, attachments)
+		}
+	}
+
+	for _, value := range embedded {
+		replaceFields(value, result, claimed, attachments)
+	}
+}
+
+func reconstruct(data interface{}, attachments [][]byte) (interface{}, error) {
+	switch v := data.(type) {
+	case []interface{}:
+		for i := range v {
+			item, err := reconstruct(v[i], attachments)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = item
+		}
+	case map[string]interface{}:
+		if isPlaceholder, _ := v["_placeholder"].(bool); isPlaceholder {
+			num, ok := v["num"].(json.Number)
+			if !ok {
+				return nil, errorWrongAttachment
+			}
+			n, err := num.Int64()
+			if err != nil || n < 0 || n >= int64(len(attachments)) {
+				return nil, errorWrongAttachment
+			}
+			return base64.StdEncoding.EncodeToString(attachments[n]), nil
+		}
+		for k, item := range v {
+			item, err := reconstruct(item, attachments)
+			if err != nil {
+				return nil, err
+			}
+			v[k] = item
+		}
+	}
+	return data, nil
+}
+
+/*
+*
+Whether a value of type t may hold a []byte, types marshalling themselves
+are left to encoding/json
+*/
+func containsBinary(t reflect.Type) bool {
+	if known, ok := binaryTypes.Load(t); ok {
+		return known.(bool)
+	}
+
+	result := hasBinary(t, make(map[reflect.Type]bool))
+	binaryTypes.Store(t, result)
+	return result
+}
+
+func hasBinary(t reflect.Type, visiting map[reflect.Type]bool) bool {
+	if visiting[t] {
+		//recursive type, decided by the other fields
+		return false
+	}
+	visiting[t] = true
+
+	if t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType) ||
+		t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType) {
+		return false
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.Uint8 || hasBinary(t.Elem(), visiting)
+	case reflect.Array, reflect.Ptr, reflect.Map:
+		return hasBinary(t.Elem(), visiting)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if hasBinary(t.Field(i).Type, visiting) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func mapKey(key reflect.Value) string {
+	if key.Kind() == reflect.String {
+		return key.String()
+	}
+	if tm, ok := key.Interface().(encoding.TextMarshaler); ok {
+		text, _ := tm.MarshalText()
+		return string(text)
+	}
+	return fmt.Sprint(key.Interface())
+}
@@ -0,0 +1,178 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeAttachmentCount(t *testing.T) {
+	for _, packet := range []string{
+		`45999999999999999-["upload",{"_placeholder":true,"num":0}]`,
+		`45100000000-["upload",{"_placeholder":true,"num":0}]`,
+		`451001-["upload",{"_placeholder":true,"num":0}]`,
+		`450-["upload"]`,
+		`45-1-["upload"]`,
+		`45x-["upload"]`,
+		`45["upload"]`,
+	} {
+		if _, err := Decode(packet); err != errorWrongPacket {
+			t.Errorf("Decode(%.30q) = %v, want errorWrongPacket", packet, err)
+		}
+	}
+
+	m, err := Decode(`451000-["upload",{"_placeholder":true,"num":0}]`)
+	if err != nil || len(m.Attachments) != maxAttachments {
+		t.Fatalf("Decode at the limit: %v", err)
+	}
+}
+
+func TestBinaryPacketCodec(t *testing.T) {
+	tests := []struct {
+		packet string
+		want   Message
+	}{
+		{`451-["upload",{"_placeholder":true,"num":0}]`,
+			Message{Type: MessageTypeEmit, Method: "upload", Args: `{"_placeholder":true,"num":0}`}},
+		{`452-/files,7["upload","a.bin",{"_placeholder":true,"num":0},{"_placeholder":true,"num":1}]`,
+			Message{Type: MessageTypeAckRequest, Namespace: "/files", AckID: 7, Method: "upload",
+				Args: `"a.bin",{"_placeholder":true,"num":0},{"_placeholder":true,"num":1}`}},
+		{`461-3[{"_placeholder":true,"num":0}]`,
+			Message{Type: MessageTypeAckResponse, AckID: 3, Args: `{"_placeholder":true,"num":0}`}},
+	}
+	for _, test := range tests {
+		m, err := Decode(test.packet)
+		if err != nil {
+			t.Fatalf("Decode(%q): %v", test.packet, err)
+		}
+		count := len(m.Attachments)
+		if m.Type != test.want.Type || m.Namespace != test.want.Namespace || m.AckID != test.want.AckID ||
+			m.Method != test.want.Method || m.Args != test.want.Args {
+			t.Errorf("Decode(%q) = %+v, want %+v", test.packet, m, test.want)
+		}
+
+		for i := range m.Attachments {
+			m.Attachments[i] = []byte{byte(i)}
+		}
+		out, err := Encode(m)
+		if err != nil || out != test.packet {
+			t.Errorf("Encode(Decode(%q)) = %q, %v", test.packet, out, err)
+		}
+		if want := strings.Count(test.packet, "_placeholder"); count != want {
+			t.Errorf("Decode(%q) has %d attachments, want %d", test.packet, count, want)
+		}
+	}
+}
+
+type fileInfo struct {
+	Name    string `json:"name"`
+	Content []byte `json:"content"`
+	Skipped []byte `json:"-"`
+	Thumb   []byte `json:"thumb,omitempty"`
+	hidden  []byte
+}
+
+type Meta struct {
+	Checksum []byte
+	Size     int
+}
+
+type upload struct {
+	Meta
+	File  *fileInfo         `json:"file"`
+	Parts [2][]byte         `json:"parts"`
+	Tags  map[string][]byte `json:"tags"`
+	Extra interface{}       `json:"extra"`
+}
+
+func TestDeconstructArgs(t *testing.T) {
+	args := []interface{}{
+		"plain",
+		[]byte{1},
+		&upload{
+			Meta:  Meta{Checksum: []byte{2}, Size: 3},
+			File:  &fileInfo{Name: "a", Content: []byte{3}, Skipped: []byte{9}, hidden: []byte{9}},
+			Parts: [2][]byte{{4}, nil},
+			Tags:  map[string][]byte{"k": {5}},
+			Extra: []interface{}{[]byte{6}, 7},
+		},
+	}
+	result, attachments := DeconstructArgs(args)
+
+	if len(attachments) != 6 {
+		t.Fatalf("%d attachments, want 6: %v", len(attachments), attachments)
+	}
+	seen := make(map[byte]bool)
+	for _, a := range attachments {
+		if len(a) != 1 || a[0] == 9 || seen[a[0]] {
+			t.Fatalf("unexpected attachments %v", attachments)
+		}
+		seen[a[0]] = true
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte(`"AQ`)) || bytes.Count(data, []byte(`"_placeholder":true`)) != 6 {
+		t.Fatalf("binary data left in %s", data)
+	}
+	if !bytes.Contains(data, []byte(`"name":"a"`)) || !bytes.Contains(data, []byte(`"Size":3`)) ||
+		bytes.Contains(data, []byte(`"thumb"`)) || bytes.Contains(data, []byte(`Skipped`)) {
+		t.Fatalf("struct fields not marshalled as encoding/json does: %s", data)
+	}
+
+	//every placeholder goes back to its own attachment
+	args2 := string(data[1 : len(data)-1])
+	rebuilt, err := ReconstructArgs(args2, attachments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded []json.RawMessage
+	if err := json.Unmarshal([]byte("["+rebuilt+"]"), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	var second []byte
+	var third upload
+	if err := json.Unmarshal(decoded[1], &second); err != nil || !bytes.Equal(second, []byte{1}) {
+		t.Fatalf("second arg %s: %v", decoded[1], err)
+	}
+	if err := json.Unmarshal(decoded[2], &third); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(third.Checksum, []byte{2}) || !bytes.Equal(third.File.Content, []byte{3}) ||
+		!bytes.Equal(third.Parts[0], []byte{4}) || third.Parts[1] != nil || !bytes.Equal(third.Tags["k"], []byte{5}) {
+		t.Fatalf("rebuilt %+v %+v", third, third.File)
+	}
+}
+
+func TestDeconstructWithoutBinary(t *testing.T) {
+	args := []interface{}{"a", 1, map[string]int{"b": 2}, json.RawMessage(`{"c":3}`)}
+	result, attachments := DeconstructArgs(args)
+	if attachments != nil || !reflect.DeepEqual(result, args) {
+		t.Fatalf("DeconstructArgs changed args without binary: %v %v", result, attachments)
+	}
+}
+
+func TestReconstructArgsErrors(t *testing.T) {
+	for _, args := range []string{
+		`{"_placeholder":true,"num":1}`,
+		`{"_placeholder":true,"num":-1}`,
+		`{"_placeholder":true,"num":"0"}`,
+		`{"_placeholder":true}`,
+	} {
+		if _, err := ReconstructArgs(args, [][]byte{{1}}); err != errorWrongAttachment {
+			t.Errorf("ReconstructArgs(%s) = %v, want errorWrongAttachment", args, err)
+		}
+	}
+	if _, err := ReconstructArgs(`{"_placeholder":`, nil); err == nil {
+		t.Error("ReconstructArgs accepted broken JSON")
+	}
+
+	out, err := ReconstructArgs(`"<tag>",{"_placeholder":false,"num":0}`, nil)
+	if err != nil || out != `"<tag>",{"_placeholder":false,"num":0}` {
+		t.Errorf("ReconstructArgs = %q, %v", out, err)
+	}
+}
@@ -17,13 +17,29 @@ const (
 	MessageTypeAckRequest
 	// MessageTypeAckResponse - Reply to ack
 	MessageTypeAckResponse
+	// MessageTypeDisconnect - Namespace disconnect (41)
+	MessageTypeDisconnect
+	// MessageTypeConnectError - Namespace connection refused (44)
+	MessageTypeConnectError
+	// MessageTypeNoop - Engine.IO noop, used to end pending polls
+	MessageTypeNoop
+	// MessageTypeUpgrade - Engine.IO upgrade, switches the session to the probed transport
+	MessageTypeUpgrade
 )
 
+// MessageTypeConnect - Namespace connect, sent as 40 (same packet as MessageTypeEmpty)
+const MessageTypeConnect = MessageTypeEmpty
+
 // Message - a message
+// - Namespace is empty for the root namespace
+// - Attachments are the binary parts of a binary event or ack (45/46),
+// they are sent as separate messages right after the packet
 type Message struct {
-	Type   int
-	AckID  int
-	Method string
-	Args   string
-	Source string
+	Type        int
+	AckID       int
+	Namespace   string
+	Method      string
+	Args        string
+	Source      string
+	Attachments [][]byte
 }
@@ -8,7 +8,8 @@ import (
 )
 
 const (
-	open = "0"
+	//OpenMessage - Handshake sent by the server, followed by the JSON header
+	OpenMessage = "0"
 	//CloseMessage - Request to close connection
 	CloseMessage = "1"
 	//PingMessage - Ping request
@@ -16,10 +17,29 @@ const (
 	//PongMessage - Pong reply
 	PongMessage = "3"
 	msg         = "4"
+	noop        = "6"
 	msgEmpty    = "0" //Append after msg (40)
 	msgCommon   = "2" //Append after msg (42)
 	msgAck      = "3" //Append after msg (43)
 
+	msgDisconnect   = "1" //Append after msg (41)
+	msgConnectError = "4" //Append after msg (44)
+	msgBinaryEvent  = "5" //Append after msg (45)
+	msgBinaryAck    = "6" //Append after msg (46)
+
+	//BinaryMessage - Prefix of the binary attachments exchanged with the transport,
+	//followed by the raw bytes
+	BinaryMessage = "b"
+
+	//UpgradeMessage - Switch the session to the probed transport
+	UpgradeMessage = "5"
+	//ProbeMessage - Ping sent over a transport before upgrading to it
+	ProbeMessage = PingMessage + "probe"
+	//ProbeReplyMessage - Server reply to ProbeMessage
+	ProbeReplyMessage = PongMessage + "probe"
+
+	//most binary attachments a packet may announce, the count comes from the peer
+	maxAttachments = 1000
 )
 
 var (
@@ -30,19 +50,27 @@ var (
 func typeToText(msgType int) (string, error) {
 	switch msgType {
 	case MessageTypeOpen:
-		return open, nil
+		return OpenMessage, nil
 	case MessageTypeClose:
 		return CloseMessage, nil
 	case MessageTypePing:
 		return PingMessage, nil
 	case MessageTypePong:
 		return PongMessage, nil
+	case MessageTypeNoop:
+		return noop, nil
+	case MessageTypeUpgrade:
+		return UpgradeMessage, nil
 	case MessageTypeEmpty:
 		return msg + msgEmpty, nil
 	case MessageTypeEmit, MessageTypeAckRequest:
 		return msg + msgCommon, nil
 	case MessageTypeAckResponse:
 		return msg + msgAck, nil
+	case MessageTypeDisconnect:
+		return msg + msgDisconnect, nil
+	case MessageTypeConnectError:
+		return msg + msgConnectError, nil
 	}
 	return "", errorUnknownMessageType
 }
@@ -55,14 +83,34 @@ func Encode(m *Message) (string, error) {
 	}
 
 	switch m.Type {
-	case MessageTypeEmpty, MessageTypePing, MessageTypePong:
+	case MessageTypePing, MessageTypePong, MessageTypeNoop, MessageTypeUpgrade:
 		return mtype, nil
+	case MessageTypeOpen, MessageTypeClose:
+		return mtype + m.Args, nil
+	}
+
+	if len(m.Attachments) > 0 {
+		switch m.Type {
+		case MessageTypeEmit, MessageTypeAckRequest:
+			mtype = msg + msgBinaryEvent
+		case MessageTypeAckResponse:
+			mtype = msg + msgBinaryAck
+		}
+		mtype += strconv.Itoa(len(m.Attachments)) + "-"
+	}
+
+	if m.Namespace != "" && m.Namespace != "/" {
+		mtype += m.Namespace + ","
+	}
+
+	switch m.Type {
+	case MessageTypeEmpty, MessageTypeDisconnect, MessageTypeConnectError:
+		//EIO4 connect may carry an auth payload, connect error carries the reason
+		return mtype + m.Args, nil
 	case MessageTypeAckRequest:
 		mtype += strconv.Itoa(m.AckID)
 	case MessageTypeAckResponse:
 		return mtype + strconv.Itoa(m.AckID) + "[" + m.Args + "]", nil
-	case MessageTypeOpen, MessageTypeClose:
-		return mtype + m.Args, nil
 	}
 
 	jsonMethod, err := json.Marshal(&m.Method)
@@ -70,6 +118,9 @@ func Encode(m *Message) (string, error) {
 		return "", err
 	}
 
+	if m.Args == "" {
+		return mtype + "[" + string(jsonMethod) + "]", nil
+	}
 	return mtype + "[" + string(jsonMethod) + "," + m.Args + "]", nil
 }
 
@@ -88,7 +139,7 @@ func getMessageType(data string) (int, error) {
 		return 0, errorUnknownMessageType
 	}
 	switch data[0:1] {
-	case open:
+	case OpenMessage:
 		return MessageTypeOpen, nil
 	case CloseMessage:
 		return MessageTypeClose, nil
@@ -96,6 +147,10 @@ func getMessageType(data string) (int, error) {
 		return MessageTypePing, nil
 	case PongMessage:
 		return MessageTypePong, nil
+	case noop:
+		return MessageTypeNoop, nil
+	case UpgradeMessage:
+		return MessageTypeUpgrade, nil
 	case msg:
 		if len(data) == 1 {
 			return 0, errorUnknownMessageType
@@ -103,24 +158,67 @@ func getMessageType(data string) (int, error) {
 		switch data[1:2] {
 		case msgEmpty:
 			return MessageTypeEmpty, nil
-		case msgCommon:
+		case msgCommon, msgBinaryEvent:
 			return MessageTypeAckRequest, nil
-		case msgAck:
+		case msgAck, msgBinaryAck:
 			return MessageTypeAckResponse, nil
+		case msgDisconnect:
+			return MessageTypeDisconnect, nil
+		case msgConnectError:
+			return MessageTypeConnectError, nil
 		}
 	}
 	return 0, errorUnknownMessageType
 }
 
+/*
+*
+Get the number of binary attachments announced by a binary packet, at most
+maxAttachments
+*/
+func getAttachments(text string) (count int, restText string, err error) {
+	pos := strings.IndexByte(text, '-')
+	if pos == -1 {
+		return 0, "", errorWrongPacket
+	}
+
+	count, err = strconv.Atoi(text[0:pos])
+	if err != nil || count < 1 || count > maxAttachments {
+		return 0, "", errorWrongPacket
+	}
+
+	return count, text[pos+1:], nil
+}
+
+/*
+*
+Get namespace of current packet, if present (the root namespace is empty)
+*/
+func getNamespace(text string) (namespace, restText string) {
+	if !strings.HasPrefix(text, "/") {
+		return "", text
+	}
+
+	pos := strings.IndexByte(text, ',')
+	if pos == -1 {
+		namespace, text = text, ""
+	} else {
+		namespace, text = text[0:pos], text[pos+1:]
+	}
+	if namespace == "/" {
+		namespace = ""
+	}
+	return namespace, text
+}
+
 /*
 *
 Get ack id of current packet, if present
 */
 func getAck(text string) (AckID int, restText string, err error) {
-	if len(text) < 4 {
+	if len(text) < 2 {
 		return 0, "", errorWrongPacket
 	}
-	text = text[2:]
 
 	pos := strings.IndexByte(text, '[')
 	if pos == -1 {
@@ -185,23 +283,45 @@ func Decode(data string) (*Message, error) {
 	case MessageTypeOpen:
 		m.Args = data[1:]
 		return m, nil
-	case MessageTypeClose, MessageTypePing, MessageTypePong, MessageTypeEmpty:
+	case MessageTypeClose, MessageTypePing, MessageTypePong, MessageTypeNoop, MessageTypeUpgrade:
+		return m, nil
+	}
+
+	body := data[2:]
+	if data[1:2] == msgBinaryEvent || data[1:2] == msgBinaryAck {
+		var count int
+		count, body, err = getAttachments(body)
+		if err != nil {
+			return nil, err
+		}
+		//filled by the receiver as the binary messages arrive
+		m.Attachments = make([][]byte, count)
+	}
+
+	m.Namespace, body = getNamespace(body)
+	switch m.Type {
+	case MessageTypeEmpty, MessageTypeDisconnect, MessageTypeConnectError:
+		m.Args = body
 		return m, nil
 	}
 
-	ack, rest, err := getAck(data)
+	ack, rest, err := getAck(body)
 	m.AckID = ack
 	if m.Type == MessageTypeAckResponse {
 		if err != nil {
 			return nil, err
 		}
+		//the arguments are between the brackets, the peer may have sent neither
+		if len(rest) < 2 || rest[len(rest)-1] != ']' {
+			return nil, errorWrongPacket
+		}
 		m.Args = rest[1 : len(rest)-1]
 		return m, nil
 	}
 
 	if err != nil {
 		m.Type = MessageTypeEmit
-		rest = data[2:]
+		rest = body
 	}
 
 	m.Method, m.Args, err = getMethod(rest)
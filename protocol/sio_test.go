@@ -0,0 +1,46 @@
+package protocol
+
+import "testing"
+
+func TestDecodeMalformedAck(t *testing.T) {
+	for _, packet := range []string{
+		`431[`,
+		`43/a,1[`,
+		`461-1[`,
+		`431["a"`,
+		`4312`,
+		`43/a,`,
+	} {
+		if m, err := Decode(packet); err == nil {
+			t.Errorf("Decode(%q) = %+v, want an error", packet, m)
+		}
+	}
+
+	m, err := Decode(`43/a,1[]`)
+	if err != nil || m.Namespace != "/a" || m.AckID != 1 || m.Args != "" {
+		t.Fatalf("Decode of an empty ack: %+v %v", m, err)
+	}
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	//every prefix of a valid packet decodes or fails, none panics
+	for _, packet := range []string{
+		`40/admin,{"token":"x"}`,
+		`42/admin,12["event",{"a":[1,2]}]`,
+		`43/admin,12["reply",1]`,
+		`451-/files,3["upload",{"_placeholder":true,"num":0}]`,
+		`461-/files,3[{"_placeholder":true,"num":0}]`,
+		`44/admin,{"message":"refused"}`,
+	} {
+		for i := 0; i <= len(packet); i++ {
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						t.Errorf("Decode(%q) panicked: %v", packet[:i], r)
+					}
+				}()
+				Decode(packet[:i])
+			}()
+		}
+	}
+}
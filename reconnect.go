@@ -0,0 +1,179 @@
+package gosio
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+var (
+	errorClientClosed = errors.New("Client closed")
+)
+
+/**
+Callbacks of the reconnection lifecycle
+*/
+type reconnectHandlers struct {
+	onAttempt func(attempt int)
+	onSuccess func(attempt int)
+	onFailed  func()
+	//attempts since the client was last connected
+	attempts int
+	lock     sync.Mutex
+}
+
+// OnReconnectAttempt - called before every reconnection attempt, counting from 1
+func (c *Client) OnReconnectAttempt(f func(attempt int)) {
+	c.reconnect.lock.Lock()
+	c.reconnect.onAttempt = f
+	c.reconnect.lock.Unlock()
+}
+
+// OnReconnect - called once reconnected (before OnConnection), with the number
+// of attempts it took
+func (c *Client) OnReconnect(f func(attempt int)) {
+	c.reconnect.lock.Lock()
+	c.reconnect.onSuccess = f
+	c.reconnect.lock.Unlock()
+}
+
+// OnReconnectFailed - called when ReconnectionAttempts are exhausted
+func (c *Client) OnReconnectFailed(f func()) {
+	c.reconnect.lock.Lock()
+	c.reconnect.onFailed = f
+	c.reconnect.lock.Unlock()
+}
+
+/**
+Delay before the given attempt (from 1): exponential from min to max,
+randomized by jitter either way
+*/
+type backoff struct {
+	min    time.Duration
+	max    time.Duration
+	jitter float64
+}
+
+func (b *backoff) duration(attempt int) time.Duration {
+	d := float64(b.min) * math.Pow(2, float64(attempt-1))
+	if b.max > 0 {
+		//keeps d finite for large attempts
+		d = math.Min(d, float64(b.max))
+	}
+	if b.jitter > 0 {
+		deviation := rand.Float64() * b.jitter * d
+		if rand.Intn(2) == 0 {
+			d -= deviation
+		} else {
+			d += deviation
+		}
+	}
+	if b.max > 0 && d > float64(b.max) {
+		return b.max
+	}
+	return time.Duration(d)
+}
+
+/**
+Wait for the channel to close and start reconnecting when the connection
+was lost, a disconnect asked by the server or by Close is final
+*/
+func (c *Client) supervise(ch *Channel, stop chan struct{}) {
+	<-ch.closed
+
+	select {
+	case <-stop:
+		return
+	default:
+	}
+	if !c.Reconnection {
+		return
+	}
+	if reason := ch.DisconnectReason(); reason == ReasonServerDisconnect {
+		glog.V(2).Infof("Not reconnecting: %s", reason)
+		return
+	}
+
+	c.reconnectLoop(stop)
+}
+
+func (c *Client) reconnectLoop(stop chan struct{}) {
+	b := backoff{
+		min:    c.ReconnectionDelay,
+		max:    c.ReconnectionDelayMax,
+		jitter: c.RandomizationFactor,
+	}
+
+	for {
+		//counting goes on over sessions lost before they connected
+		c.reconnect.lock.Lock()
+		c.reconnect.attempts++
+		attempt := c.reconnect.attempts
+		onAttempt := c.reconnect.onAttempt
+		c.reconnect.lock.Unlock()
+
+		if c.ReconnectionAttempts > 0 && attempt > c.ReconnectionAttempts {
+			break
+		}
+
+		select {
+		case <-time.After(b.duration(attempt)):
+		case <-stop:
+			return
+		}
+		if c.IsAlive() {
+			//dialed again in the meantime (e.g. from OnDisconnect)
+			return
+		}
+
+		if onAttempt != nil {
+			onAttempt(attempt)
+		}
+
+		if _, err := c.dial(context.Background(), stop); err != nil {
+			if err == errorClientClosed {
+				return
+			}
+			glog.Errorf("Reconnection attempt %d failed: %s", attempt, err)
+			continue
+		}
+		//supervise takes over, OnReconnect is called once connected
+		return
+	}
+
+	glog.Errorf("Giving up reconnecting after %d attempts", c.ReconnectionAttempts)
+	c.resetAttempts()
+	c.reconnect.lock.Lock()
+	onFailed := c.reconnect.onFailed
+	c.reconnect.lock.Unlock()
+	if onFailed != nil {
+		onFailed()
+	}
+}
+
+/**
+The client is connected: OnReconnect is told how many attempts it took and
+counting starts over
+*/
+func (c *Client) connected() {
+	c.reconnect.lock.Lock()
+	attempts := c.reconnect.attempts
+	c.reconnect.attempts = 0
+	onSuccess := c.reconnect.onSuccess
+	c.reconnect.lock.Unlock()
+
+	if attempts > 0 && onSuccess != nil {
+		onSuccess(attempts)
+	}
+}
+
+func (c *Client) resetAttempts() {
+	c.reconnect.lock.Lock()
+	c.reconnect.attempts = 0
+	c.reconnect.lock.Unlock()
+}
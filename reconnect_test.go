@@ -0,0 +1,153 @@
+package gosio
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gnabgib/go-sio/transport"
+	"github.com/gorilla/websocket"
+)
+
+func TestBackoff(t *testing.T) {
+	b := backoff{min: 100 * time.Millisecond, max: time.Second}
+	want := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for i, w := range want {
+		if d := b.duration(i + 1); d != w*time.Millisecond {
+			t.Errorf("attempt %d: %s, want %s", i+1, d, w*time.Millisecond)
+		}
+	}
+	if d := b.duration(5000); d != time.Second {
+		t.Errorf("attempt 5000: %s", d)
+	}
+
+	b.jitter = 0.5
+	for attempt := 1; attempt <= 6; attempt++ {
+		base := want[attempt-1] * time.Millisecond
+		low, high := base/2, base*3/2
+		if high > b.max {
+			high = b.max
+		}
+		for i := 0; i < 200; i++ {
+			if d := b.duration(attempt); d < low || d > high {
+				t.Fatalf("attempt %d: %s out of [%s, %s]", attempt, d, low, high)
+			}
+		}
+	}
+}
+
+// reconnectingClient dials u with short delays, the lifecycle callbacks are
+// recorded into the returned channels
+func reconnectingClient(u *url.URL, attempts int) (*Client, chan int, chan int, chan bool) {
+	c := New(u, transport.GetDefaultWebsocketTransport())
+	c.Version = EIO4
+	c.Reconnection = true
+	c.ReconnectionAttempts = attempts
+	c.ReconnectionDelay = 10 * time.Millisecond
+	c.ReconnectionDelayMax = 20 * time.Millisecond
+
+	tried := make(chan int, 16)
+	reconnected := make(chan int, 16)
+	failed := make(chan bool, 1)
+	c.OnReconnectAttempt(func(attempt int) { tried <- attempt })
+	c.OnReconnect(func(attempt int) { reconnected <- attempt })
+	c.OnReconnectFailed(func() { failed <- true })
+	return c, tried, reconnected, failed
+}
+
+func expectAttempts(t *testing.T, tried chan int, n int) {
+	for i := 1; i <= n; i++ {
+		select {
+		case attempt := <-tried:
+			if attempt != i {
+				t.Fatalf("attempt %d, want %d", attempt, i)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("attempt %d not made", i)
+		}
+	}
+}
+
+func TestReconnectAttemptLimit(t *testing.T) {
+	var dials int32
+	//every session is dropped after the handshake, before the namespace connects
+	srv, u := fakeServer(t, func(ws *websocket.Conn, r *http.Request) {
+		atomic.AddInt32(&dials, 1)
+		writePacket(ws, testHandshake)
+		readPacket(ws, time.Second)
+	})
+	defer srv.Close()
+
+	c, tried, reconnected, failed := reconnectingClient(u, 3)
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	expectAttempts(t, tried, 3)
+	select {
+	case <-failed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("reconnection not given up")
+	}
+	if n := atomic.LoadInt32(&dials); n != 4 {
+		t.Errorf("%d dials, want 4", n)
+	}
+	select {
+	case attempt := <-reconnected:
+		t.Errorf("reconnected after %d attempts without connecting", attempt)
+	default:
+	}
+}
+
+func TestReconnectAfterFailedDial(t *testing.T) {
+	var up int32
+	connected := make(chan bool, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&up) == 0 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		ws, err := websocket.Upgrade(w, r, nil, 1024, 1024)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		writePacket(ws, testHandshake)
+		readPacket(ws, time.Second)
+		writePacket(ws, `40{"sid":"a"}`)
+		readPacket(ws, 5*time.Second)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(strings.Replace(srv.URL, "http", "ws", 1) + "/socket.io/?transport=websocket")
+
+	c, tried, reconnected, _ := reconnectingClient(u, 0)
+	c.OnConnect(func(ch *Channel) { connected <- true })
+	disconnected := make(chan bool, 4)
+	c.OnDisconnect(func(ch *Channel) { disconnected <- true })
+
+	if err := c.Dial(); err == nil {
+		t.Fatal("dial of an unavailable server succeeded")
+	}
+	defer c.Close()
+
+	expectAttempts(t, tried, 2)
+	atomic.StoreInt32(&up, 1)
+	select {
+	case <-connected:
+	case <-time.After(2 * time.Second):
+		t.Fatal("not reconnected")
+	}
+	if attempt := <-reconnected; attempt < 2 {
+		t.Errorf("reconnected after %d attempts, 2 at least were made", attempt)
+	}
+	select {
+	case <-disconnected:
+		t.Error("OnDisconnect called for a connection that never opened")
+	default:
+	}
+}
@@ -0,0 +1,220 @@
+package gosio
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+var (
+	errorNotServerChannel = errors.New("Broadcast is only available on server channels")
+)
+
+/**
+Rooms of the clients of a server, by client ID. Every client is in the
+room named after its ID
+*/
+type roomSet struct {
+	members map[string]map[string]struct{}
+	joined  map[string]map[string]struct{}
+	lock    sync.RWMutex
+}
+
+func newRoomSet() *roomSet {
+	return &roomSet{
+		members: make(map[string]map[string]struct{}),
+		joined:  make(map[string]map[string]struct{}),
+	}
+}
+
+func (r *roomSet) join(id string, rooms ...string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, room := range rooms {
+		if r.members[room] == nil {
+			r.members[room] = make(map[string]struct{})
+		}
+		r.members[room][id] = struct{}{}
+		if r.joined[id] == nil {
+			r.joined[id] = make(map[string]struct{})
+		}
+		r.joined[id][room] = struct{}{}
+	}
+}
+
+func (r *roomSet) leave(id string, rooms ...string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, room := range rooms {
+		delete(r.members[room], id)
+		if len(r.members[room]) == 0 {
+			delete(r.members, room)
+		}
+		delete(r.joined[id], room)
+	}
+	if len(r.joined[id]) == 0 {
+		delete(r.joined, id)
+	}
+}
+
+/**
+Leave every room, the client is gone
+*/
+func (r *roomSet) leaveAll(id string) {
+	r.leave(id, r.rooms(id)...)
+}
+
+/**
+Rooms the client is in, sorted
+*/
+func (r *roomSet) rooms(id string) []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	rooms := make([]string, 0, len(r.joined[id]))
+	for room := range r.joined[id] {
+		rooms = append(rooms, room)
+	}
+	sort.Strings(rooms)
+	return rooms
+}
+
+/**
+Clients in any of the rooms but none of the except ones, every known client
+when no room is given
+*/
+func (r *roomSet) match(rooms, except []string) []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	ids := make(map[string]struct{})
+	if len(rooms) == 0 {
+		for id := range r.joined {
+			ids[id] = struct{}{}
+		}
+	}
+	for _, room := range rooms {
+		for id := range r.members[room] {
+			ids[id] = struct{}{}
+		}
+	}
+	for _, room := range except {
+		for id := range r.members[room] {
+			delete(ids, id)
+		}
+	}
+
+	result := make([]string, 0, len(ids))
+	for id := range ids {
+		result = append(result, id)
+	}
+	return result
+}
+
+// Broadcast - clients to emit to, selected by rooms, see Server.To and Channel.Broadcast.
+// The broadcasts of client channels reach nobody, they return an error
+type Broadcast struct {
+	server *Server
+	opts   BroadcastOptions
+}
+
+// To - Only the clients in any of the rooms (a client ID is a room too)
+func (b *Broadcast) To(rooms ...string) *Broadcast {
+	next := *b
+	next.opts.Rooms = append(append([]string(nil), b.opts.Rooms...), rooms...)
+	return &next
+}
+
+// Except - Without the clients in any of the rooms
+func (b *Broadcast) Except(rooms ...string) *Broadcast {
+	next := *b
+	next.opts.Except = append(append([]string(nil), b.opts.Except...), rooms...)
+	return &next
+}
+
+// Local - Only the clients of this node, when the adapter links several
+func (b *Broadcast) Local() *Broadcast {
+	next := *b
+	next.opts.Local = true
+	return &next
+}
+
+// Emit - Send a message to every selected client, returns the first error
+// met, the other clients get the message anyway
+func (b *Broadcast) Emit(method string, args ...interface{}) error {
+	if b.server == nil {
+		return errorNotServerChannel
+	}
+	return b.server.adapter.Broadcast(b.opts, method, args)
+}
+
+// FetchSockets - The selected clients, on every node
+func (b *Broadcast) FetchSockets() ([]SocketInfo, error) {
+	if b.server == nil {
+		return nil, errorNotServerChannel
+	}
+	return b.server.adapter.FetchSockets(b.opts)
+}
+
+// To - Clients in any of the rooms, a client ID is a room too
+func (s *Server) To(rooms ...string) *Broadcast {
+	return (&Broadcast{server: s}).To(rooms...)
+}
+
+// Except - Every client but the ones in any of the rooms
+func (s *Server) Except(rooms ...string) *Broadcast {
+	return (&Broadcast{server: s}).Except(rooms...)
+}
+
+// Emit - Send a message to every client
+func (s *Server) Emit(method string, args ...interface{}) error {
+	return (&Broadcast{server: s}).Emit(method, args...)
+}
+
+// Join - Add the client to the rooms, no-op for client channels and closed ones
+func (c *Channel) Join(rooms ...string) {
+	if c.server == nil {
+		return
+	}
+	c.aliveLock.Lock()
+	defer c.aliveLock.Unlock()
+
+	//a closed client has left its rooms, or leaves them once it is removed
+	if c.alive {
+		c.server.adapter.AddAll(c.header.Sid, rooms)
+	}
+}
+
+// Leave - Remove the client from the rooms, no-op for client channels
+func (c *Channel) Leave(rooms ...string) {
+	if c.server == nil {
+		return
+	}
+	for _, room := range rooms {
+		c.server.adapter.Del(c.header.Sid, room)
+	}
+}
+
+// Rooms - Rooms of the client, including its ID, empty for client channels
+func (c *Channel) Rooms() []string {
+	if c.server == nil {
+		return nil
+	}
+	return c.server.adapter.Rooms(c.header.Sid)
+}
+
+// Broadcast - Every client of the server but this one, narrowed with To and Except
+// - its Emit and FetchSockets fail for client channels
+func (c *Channel) Broadcast() *Broadcast {
+	if c.server == nil {
+		return &Broadcast{}
+	}
+	return c.server.Except(c.header.Sid)
+}
+
+// To - Clients in any of the rooms but this one
+func (c *Channel) To(rooms ...string) *Broadcast {
+	return c.Broadcast().To(rooms...)
+}
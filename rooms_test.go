@@ -0,0 +1,105 @@
+package gosio
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestRooms(t *testing.T) {
+	s, hs, endpoint := testServer(t)
+	defer hs.Close()
+	defer s.Close()
+	s.On("join", func(c *Channel, room string) string {
+		c.Join(room)
+		return "joined"
+	})
+	s.On("shout", func(c *Channel, msg string) string {
+		if err := c.To("room").Emit("shout", msg); err != nil {
+			return err.Error()
+		}
+		return "sent"
+	})
+
+	a, idA := connectRaw(t, endpoint)
+	defer a.Close()
+	b, idB := connectRaw(t, endpoint)
+	c, idC := connectRaw(t, endpoint)
+	defer c.Close()
+	for _, ws := range []*websocket.Conn{a, b} {
+		writePacket(ws, `421["join","room"]`)
+		if p := readSkippingPings(ws, time.Second); p != `431["joined"]` {
+			t.Fatalf("join ack %q", p)
+		}
+	}
+
+	//the first packet each client gets after the broadcast is the expected one,
+	//then its own marker
+	expect := func(step string, want map[*websocket.Conn]string) {
+		t.Helper()
+		for ws, id := range map[*websocket.Conn]string{a: idA, b: idB, c: idC} {
+			s.To(id).Emit("marker", step)
+			marker := fmt.Sprintf(`42["marker","%s"]`, step)
+			if packet, ok := want[ws]; ok {
+				if p := readSkippingPings(ws, time.Second); p != packet {
+					t.Fatalf("%s: client %s got %q, want %q", step, id, p, packet)
+				}
+			}
+			if p := readSkippingPings(ws, time.Second); p != marker {
+				t.Fatalf("%s: client %s got %q, want the marker", step, id, p)
+			}
+		}
+	}
+
+	if err := s.To("room").Emit("news", 1); err != nil {
+		t.Fatal(err)
+	}
+	expect("to", map[*websocket.Conn]string{a: `42["news",1]`, b: `42["news",1]`})
+
+	if err := s.To("room").Except(idA).Emit("news", 2); err != nil {
+		t.Fatal(err)
+	}
+	expect("except", map[*websocket.Conn]string{b: `42["news",2]`})
+
+	//broadcasts of a client reach the room without it
+	writePacket(a, `422["shout","hi"]`)
+	if p := readSkippingPings(a, time.Second); p != `432["sent"]` {
+		t.Fatalf("shout ack %q", p)
+	}
+	expect("shout", map[*websocket.Conn]string{b: `42["shout","hi"]`})
+
+	//a gone client leaves its rooms
+	b.Close()
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(10 * time.Millisecond) {
+		sockets, err := s.To("room").FetchSockets()
+		if err == nil && len(sockets) == 1 && sockets[0].ID == idA {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("sockets in room %+v %v", sockets, err)
+		}
+	}
+	if sockets, _ := s.Except().FetchSockets(); len(sockets) != 2 {
+		t.Fatalf("sockets %+v", sockets)
+	}
+}
+
+func TestClientChannelBroadcast(t *testing.T) {
+	c := &Channel{}
+	c.initChannel()
+	c.Join("room")
+	if rooms := c.Rooms(); rooms != nil {
+		t.Fatalf("rooms of a client channel %v", rooms)
+	}
+	if err := c.Broadcast().Emit("news"); err != errorNotServerChannel {
+		t.Fatalf("Broadcast().Emit error %v", err)
+	}
+	if err := c.To("room").Except("other").Local().Emit("news"); err != errorNotServerChannel {
+		t.Fatalf("To().Emit error %v", err)
+	}
+	if _, err := c.To("room").FetchSockets(); err != errorNotServerChannel {
+		t.Fatalf("FetchSockets error %v", err)
+	}
+}
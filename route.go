@@ -0,0 +1,168 @@
+package gosio
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	//kinds of pattern, a glob and a regexp of the same text are distinct
+	globKey   = "glob:"
+	regexpKey = "regexp:"
+)
+
+// Route - how an incoming event was matched, handlers get it by declaring
+// a Route parameter after the Channel: func(c *Channel, route Route, args T)
+type Route struct {
+	// Event - name of the event as received
+	Event string
+	// Pattern - glob or regexp that matched, empty for an exact match
+	Pattern string
+	// Params - segments captured by the wildcards or the regexp groups, in order
+	Params []string
+	// Named - segments captured by named regexp groups
+	Named map[string]string
+}
+
+/**
+Handlers bound to a glob or regexp instead of an exact event name, key is
+the kind followed by the source
+*/
+type pattern struct {
+	key       string
+	source    string
+	re        *regexp.Regexp
+	listeners []*listener
+}
+
+// OnPattern - Like On, for every event matching the glob, where each * matches
+// any run of characters and is captured in Route.Params (e.g. "device:*:values")
+// - handlers of the exact event name take precedence over patterns
+// - among patterns, the first one added that matches handles the event
+func (e *event) OnPattern(glob string, f interface{}) (Handle, error) {
+	return e.addPattern(globKey, glob, globRegexp(glob), f)
+}
+
+// OnRegexp - Like OnPattern, for every event matching re (anchor it with ^ and $
+// to match the whole name), the groups are captured in Route.Params and Route.Named
+func (e *event) OnRegexp(re *regexp.Regexp, f interface{}) (Handle, error) {
+	return e.addPattern(regexpKey, re.String(), re, f)
+}
+
+// OffPattern - Remove every handler added with OnPattern for the glob
+func (e *event) OffPattern(glob string) {
+	e.messageHandlersLock.Lock()
+	e.removePatterns(globKey + glob)
+	e.messageHandlersLock.Unlock()
+}
+
+// OffRegexp - Remove every handler added with OnRegexp for a regexp of the
+// same source as re
+func (e *event) OffRegexp(re *regexp.Regexp) {
+	e.messageHandlersLock.Lock()
+	e.removePatterns(regexpKey + re.String())
+	e.messageHandlersLock.Unlock()
+}
+
+func (e *event) addPattern(kind, source string, re *regexp.Regexp, f interface{}) (Handle, error) {
+	c, err := newCaller(f)
+	if err != nil {
+		return 0, err
+	}
+
+	e.messageHandlersLock.Lock()
+	defer e.messageHandlersLock.Unlock()
+
+	e.lastHandle++
+	l := &listener{handle: e.lastHandle, caller: c}
+	key := kind + source
+	for _, p := range e.patterns {
+		if p.key == key {
+			p.listeners = append(p.listeners, l)
+			return l.handle, nil
+		}
+	}
+	e.patterns = append(e.patterns, &pattern{key: key, source: source, re: re, listeners: []*listener{l}})
+	return l.handle, nil
+}
+
+/**
+Listeners of an incoming event: the ones of its exact name, otherwise the ones
+of the first matching pattern. key identifies them for claim and Off
+*/
+func (e *event) resolve(method string) (key string, listeners []*listener, route Route) {
+	e.messageHandlersLock.RLock()
+	defer e.messageHandlersLock.RUnlock()
+
+	if listeners, ok := e.messageHandlers[method]; ok {
+		return method, listeners, Route{Event: method}
+	}
+
+	for _, p := range e.patterns {
+		match := p.re.FindStringSubmatch(method)
+		if match == nil {
+			continue
+		}
+
+		route = Route{Event: method, Pattern: p.source, Params: match[1:]}
+		for i, name := range p.re.SubexpNames() {
+			if name == "" {
+				continue
+			}
+			if route.Named == nil {
+				route.Named = make(map[string]string)
+			}
+			route.Named[name] = match[i]
+		}
+		return p.key, p.listeners, route
+	}
+	return method, nil, Route{Event: method}
+}
+
+/**
+Remove the listener from its pattern, handles are unique so none has to be
+named. The lock has to be held
+*/
+func (e *event) removePatternListener(h Handle) bool {
+	for i, p := range e.patterns {
+		rest, ok := withoutListener(p.listeners, h)
+		if !ok {
+			continue
+		}
+		if len(rest) == 0 {
+			e.removePattern(i)
+		} else {
+			p.listeners = rest
+		}
+		return true
+	}
+	return false
+}
+
+/**
+Drop the patterns with the given key, the lock has to be held
+*/
+func (e *event) removePatterns(key string) {
+	for i := len(e.patterns) - 1; i >= 0; i-- {
+		if e.patterns[i].key == key {
+			e.removePattern(i)
+		}
+	}
+}
+
+func (e *event) removePattern(i int) {
+	patterns := make([]*pattern, 0, len(e.patterns)-1)
+	patterns = append(patterns, e.patterns[:i]...)
+	e.patterns = append(patterns, e.patterns[i+1:]...)
+}
+
+/**
+Compile a glob into an anchored regexp, every * becomes a group
+*/
+func globRegexp(glob string) *regexp.Regexp {
+	parts := strings.Split(glob, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, "(.*?)") + "$")
+}
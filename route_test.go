@@ -0,0 +1,101 @@
+package gosio
+
+import (
+	"regexp"
+	"testing"
+)
+
+func newTestEvent() *event {
+	e := &event{}
+	e.initMethods()
+	return e
+}
+
+func handles(listeners []*listener) []Handle {
+	result := make([]Handle, 0, len(listeners))
+	for _, l := range listeners {
+		result = append(result, l.handle)
+	}
+	return result
+}
+
+func TestGlobAndRegexpOfSameSource(t *testing.T) {
+	e := newTestEvent()
+	handler := func(c *Channel) {}
+	glob, _ := e.OnPattern("a*", handler)
+	re, _ := e.OnRegexp(regexp.MustCompile("a*"), handler)
+	exact, _ := e.On("a*", handler)
+
+	tests := []struct {
+		event   string
+		handle  Handle
+		pattern string
+	}{
+		{"abc", glob, "a*"},
+		{"xyz", re, "a*"},
+		{"a*", exact, ""},
+	}
+	for _, test := range tests {
+		_, listeners, route := e.resolve(test.event)
+		if h := handles(listeners); len(h) != 1 || h[0] != test.handle {
+			t.Errorf("%q resolved to %v, want %v", test.event, h, test.handle)
+		}
+		if route.Pattern != test.pattern {
+			t.Errorf("%q matched pattern %q, want %q", test.event, route.Pattern, test.pattern)
+		}
+	}
+
+	//each kind is removed on its own
+	e.OffAll("a*")
+	if _, listeners, _ := e.resolve("abc"); len(listeners) != 1 || listeners[0].handle != glob {
+		t.Fatal("OffAll removed a pattern")
+	}
+	e.OffPattern("a*")
+	if _, listeners, _ := e.resolve("abc"); len(listeners) != 1 || listeners[0].handle != re {
+		t.Fatal("OffPattern did not remove the glob only")
+	}
+	e.OffRegexp(regexp.MustCompile("a*"))
+	if _, listeners, _ := e.resolve("abc"); len(listeners) != 0 {
+		t.Fatal("OffRegexp did not remove the regexp")
+	}
+}
+
+func TestOffPatternHandle(t *testing.T) {
+	e := newTestEvent()
+	handler := func(c *Channel) {}
+	first, _ := e.OnPattern("device:*", handler)
+	second, _ := e.OnPattern("device:*", handler)
+	re, _ := e.OnRegexp(regexp.MustCompile(`^device:(\d+)$`), handler)
+
+	e.Off("device:*", first)
+	if _, listeners, _ := e.resolve("device:1"); len(listeners) != 1 || listeners[0].handle != second {
+		t.Fatalf("Off left %v", handles(listeners))
+	}
+	e.Off("device:*", second)
+	_, listeners, route := e.resolve("device:1")
+	if len(listeners) != 1 || listeners[0].handle != re {
+		t.Fatalf("Off left %v", handles(listeners))
+	}
+	if len(route.Params) != 1 || route.Params[0] != "1" {
+		t.Fatalf("params %v", route.Params)
+	}
+}
+
+func TestGlobRegexp(t *testing.T) {
+	tests := []struct {
+		glob  string
+		event string
+		match bool
+	}{
+		{"device:*:values", "device:42:values", true},
+		{"device:*:values", "device:42:values:x", false},
+		{"a.b", "axb", false},
+		{"*", "", true},
+		{"(x)*", "(x)y", true},
+	}
+	for _, test := range tests {
+		if got := globRegexp(test.glob).MatchString(test.event); got != test.match {
+			t.Errorf("glob %q on %q = %v", test.glob, test.event, got)
+		}
+	}
+}
@@ -1,9 +1,12 @@
 package gosio
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
+	"sync/atomic"
 	"time"
 
 	"github.com/gnabgib/go-sio/protocol"
@@ -15,6 +18,11 @@ var (
 	errorBufferOverlow = errors.New("Buffer overflow")
 )
 
+/**
+Positional arguments of an event, each one is a separate value of the packet
+*/
+type eventArgs []interface{}
+
 /**
 Send message packet to socket
 */
@@ -26,6 +34,17 @@ func send(msg *protocol.Message, c *Channel, args interface{}) error {
 		}
 	}()
 
+	msg.Namespace = c.namespace
+	list, positional := args.(eventArgs)
+	if positional && len(list) == 0 {
+		args = nil
+	}
+	switch msg.Type {
+	case protocol.MessageTypeEmit, protocol.MessageTypeAckRequest, protocol.MessageTypeAckResponse:
+		//[]byte found in args travel as binary attachments
+		args, msg.Attachments = protocol.DeconstructArgs(args)
+	}
+
 	if args != nil {
 		json, err := json.Marshal(&args)
 		if err != nil {
@@ -33,6 +52,10 @@ func send(msg *protocol.Message, c *Channel, args interface{}) error {
 		}
 
 		msg.Args = string(json)
+		if positional {
+			//the values follow the method, without brackets of their own
+			msg.Args = msg.Args[1 : len(msg.Args)-1]
+		}
 	}
 
 	command, err := protocol.Encode(msg)
@@ -40,47 +63,230 @@ func send(msg *protocol.Message, c *Channel, args interface{}) error {
 		return err
 	}
 
-	if len(c.out) == queueBufferSize {
+	//attachments have to follow their packet without interleaving
+	c.outLock.Lock()
+	defer c.outLock.Unlock()
+
+	if len(c.out)+len(msg.Attachments) >= queueBufferSize {
 		return errorBufferOverlow
 	}
 
 	glog.V(5).Info("Sending ",command)
 	c.out <- command
+	for _, attachment := range msg.Attachments {
+		c.out <- protocol.BinaryMessage + string(attachment)
+	}
 
 	return nil
 }
 
-// Emit - Send a message to the server (do not expect a response)
-func (c *Channel) Emit(method string, args interface{}) error {
+/**
+Send an event or ack request, OnAnyOutgoing handlers see it once queued
+*/
+func sendEvent(msg *protocol.Message, c *Channel, args interface{}) error {
+	if err := send(msg, c, args); err != nil {
+		return err
+	}
+	notifyOutgoing(c, msg)
+	return nil
+}
+
+/**
+Pass an event sent over c to its OnAnyOutgoing listeners
+*/
+func notifyOutgoing(c *Channel, msg *protocol.Message) {
+	if c.events != nil {
+		c.events.callAnyOutgoing(c, msg)
+	}
+}
+
+// Emit - Send a message to the server (do not expect a response), every arg
+// is a separate argument of the event
+// - once the channel is closed, the message goes to the offline buffer of its client
+func (c *Channel) Emit(method string, args ...interface{}) error {
+	if !c.IsAlive() {
+		if c.owner != nil {
+			return c.owner.Emit(method, args...)
+		}
+		return errorNotConnected
+	}
+
 	msg := &protocol.Message{
 		Type:   protocol.MessageTypeEmit,
 		Method: method,
 	}
 
-	return send(msg, c, args)
+	return sendEvent(msg, c, eventArgs(args))
+}
+
+// EmitContext - Emit, unless ctx is already done (queuing the message does not block)
+func (c *Channel) EmitContext(ctx context.Context, method string, args ...interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.Emit(method, args...)
 }
 
 // Ack - Send a message to the server, expect a response
 func (c *Channel) Ack(method string, args interface{}, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	result, err := c.AckContext(ctx, method, args)
+	if err == context.DeadlineExceeded {
+		return "", errorSendTimeout
+	}
+	return result, err
+}
+
+// AckContext - Send a message to the server, wait for the response until ctx is done
+func (c *Channel) AckContext(ctx context.Context, method string, args interface{}) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	f := c.ackRequest(method, args)
+	select {
+	case <-f.Done():
+	case <-ctx.Done():
+		//no-op when the response won the race
+		f.complete("", ctx.Err())
+	}
+	return f.Wait()
+}
+
+// AckAsync - Send a message to the server without waiting for the response,
+// the future fails with ctx.Err() once ctx is done
+func (c *Channel) AckAsync(ctx context.Context, method string, args interface{}) *AckFuture {
+	if err := ctx.Err(); err != nil {
+		return failedAck(method, err)
+	}
+
+	f := c.ackRequest(method, args)
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-f.Done():
+			case <-ctx.Done():
+				f.complete("", ctx.Err())
+			}
+		}()
+	}
+	return f
+}
+
+// EmitWithAck - Send a message to the server, callback is called (from its own
+// goroutine) with the response, the returned future allows to cancel waiting
+func (c *Channel) EmitWithAck(method string, args interface{},
+	callback func(result string, err error)) *AckFuture {
+	f := c.AckAsync(context.Background(), method, args)
+	go func() {
+		callback(f.Wait())
+	}()
+	return f
+}
+
+/**
+Register the waiter of an ack request and send it
+*/
+func (c *Channel) ackRequest(method string, args interface{}) *AckFuture {
+	f := c.ack.newFuture(method)
+	if err := c.disconnectError(); err != nil {
+		//registered after closeChannel failed the pending ones
+		f.complete("", err)
+		return f
+	}
 	msg := &protocol.Message{
 		Type:   protocol.MessageTypeAckRequest,
-		AckID:  c.ack.nextID(),
+		AckID:  f.id,
 		Method: method,
 	}
 
-	waiter := make(chan string)
-	c.ack.addWaiter(msg.AckID, waiter)
+	if err := sendEvent(msg, c, args); err != nil {
+		f.complete("", err)
+	}
+	return f
+}
+
+/**
+Answer of the ack request msg, only the first reply is sent
+*/
+func ackReplier(c *Channel, msg *protocol.Message) func(args interface{}) {
+	var replied int32
+	return func(args interface{}) {
+		if !atomic.CompareAndSwapInt32(&replied, 0, 1) {
+			glog.V(2).Infof("Ack %d of %q already answered", msg.AckID, msg.Method)
+			return
+		}
+		if !c.IsAlive() {
+			glog.V(2).Infof("Ack %d of %q answered after disconnection", msg.AckID, msg.Method)
+			return
+		}
+
+		ack := &protocol.Message{
+			Type:  protocol.MessageTypeAckResponse,
+			AckID: msg.AckID,
+		}
+		if err := send(ack, c, args); err != nil {
+			glog.Errorf("Failed to answer ack %d of %q: %s", msg.AckID, msg.Method, err)
+		}
+	}
+}
 
-	err := send(msg, c, args)
+// AckInto - Like AckContext, the values of the response are decoded into out
+// (one pointer per value, in order)
+func (c *Channel) AckInto(ctx context.Context, method string, args interface{}, out ...interface{}) error {
+	result, err := c.AckContext(ctx, method, args)
 	if err != nil {
-		c.ack.removeWaiter(msg.AckID)
+		return err
 	}
+	return decodeAck(method, result, out)
+}
 
-	select {
-	case result := <-waiter:
-		return result, nil
-	case <-time.After(timeout):
-		c.ack.removeWaiter(msg.AckID)
-		return "", errorSendTimeout
+// AckResult - Like AckInto, an error answered by the handler (in the AckErrors
+// convention of the client) is returned as *AckError
+func (c *Channel) AckResult(ctx context.Context, method string, args interface{}, out ...interface{}) error {
+	result, err := c.AckContext(ctx, method, args)
+	if err != nil {
+		return err
+	}
+	return c.decodeAckResult(method, result, out)
+}
+
+/**
+Decode the values of an ack response, the response holds them comma separated
+*/
+func decodeAck(method, result string, out []interface{}) error {
+	values, err := ackValues(method, result)
+	if err != nil {
+		return err
+	}
+	return bindAck(method, values, out)
+}
+
+/**
+Split an ack response into its values
+*/
+func ackValues(method, result string) ([]json.RawMessage, error) {
+	var values []json.RawMessage
+	if err := json.Unmarshal([]byte("["+result+"]"), &values); err != nil {
+		return nil, fmt.Errorf("Ack %q: wrong response: %w", method, err)
 	}
+	return values, nil
+}
+
+/**
+Unmarshal the values of an ack response into out, in order
+*/
+func bindAck(method string, values []json.RawMessage, out []interface{}) error {
+	if len(values) < len(out) {
+		return fmt.Errorf("Ack %q: %d values received, %d expected", method, len(values), len(out))
+	}
+
+	for i, target := range out {
+		if err := json.Unmarshal(values[i], target); err != nil {
+			return fmt.Errorf("Ack %q: value %d: %w", method, i, err)
+		}
+	}
+	return nil
 }
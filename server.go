@@ -0,0 +1,310 @@
+package gosio
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gnabgib/go-sio/protocol"
+	"github.com/gnabgib/go-sio/transport"
+	"github.com/golang/glog"
+)
+
+const (
+	//largest payload announced to clients, in bytes
+	defaultMaxPayload = 1000000
+)
+
+// Server - accepts socket.io clients, serve it with http.Handle("/socket.io/", server)
+// - On, OnConnect, OnDisconnect... register the handlers shared by every client
+// - handlers receive the Channel of the client, Emit and Ack on it reach that client
+// - only the root namespace is served, connecting to another one is refused
+// - middlewares added with Use decide whether a client is admitted
+type Server struct {
+	event
+	tr transport.Transport
+
+	// AckErrors - how errors returned by handlers are answered to ack requests
+	// and found by AckResult, AckErrorObject when nil
+	AckErrors AckErrorFormat
+	// Workers - handlers running at the same time for each client, 0 for a
+	// goroutine per message
+	Workers int
+	// OrderKey - events of the same key are handled in order when Workers is set
+	OrderKey OrderKey
+
+	channels     map[string]*Channel
+	channelsLock sync.RWMutex
+
+	id             string
+	adapter        Adapter
+	serverSide     []func(event string, args json.RawMessage)
+	serverSideLock sync.RWMutex
+
+	middlewares     []Middleware
+	middlewaresLock sync.RWMutex
+}
+
+// NewServer - Server accepting clients with the given transport (websocket)
+func NewServer(tr transport.Transport) *Server {
+	s := &Server{
+		tr:       tr,
+		channels: make(map[string]*Channel),
+		id:       newID(),
+	}
+	s.initMethods()
+	s.ackErrors = s.ackErrorSettings
+	if err := s.SetAdapter(NewMemoryAdapter()); err != nil {
+		//a memory adapter starts without error
+		panic(err)
+	}
+
+	return s
+}
+
+// ServeHTTP - Open the session of a new client, the handshake announces the
+// ping settings of the transport
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.tr.HandleConnection(w, r)
+	if err != nil {
+		glog.Errorf("Failed to accept connection: %s", err)
+		return
+	}
+
+	c := &Channel{events: &s.event}
+	c.initChannel()
+	c.conn = conn
+	c.server = s
+	c.request = r
+	c.version = EIO3
+	if r.URL.Query().Get("EIO") == "4" {
+		c.version = EIO4
+	}
+	if s.Workers > 0 {
+		c.dispatcher = newDispatcher(s.Workers, s.OrderKey, c.closed)
+	}
+
+	interval, timeout := conn.PingParams()
+	c.header = Header{
+		Sid:          newID(),
+		Upgrades:     []string{},
+		PingInterval: int(interval / time.Millisecond),
+		PingTimeout:  int(timeout / time.Millisecond),
+		MaxPayload:   defaultMaxPayload,
+	}
+	handshake, err := json.Marshal(&c.header)
+	if err != nil {
+		glog.Errorf("Failed to encode handshake: %s", err)
+		conn.Close()
+		return
+	}
+	c.out <- protocol.OpenMessage + string(handshake)
+
+	s.add(c)
+	go func() {
+		<-c.closed
+		s.remove(c)
+	}()
+
+	go workerLoop(c, &s.event)
+	go inLoop(c, &s.event)
+	go outLoop(c, &s.event)
+	if c.dispatcher != nil {
+		c.dispatcher.start(c, &s.event)
+	}
+	if c.version == EIO4 {
+		//EIO4 clients answer the pings of the server, EIO3 ones send them
+		go pinger(c)
+	}
+	go pingWatchdog(c, &s.event, c.header.heartbeatTimeout())
+
+	if c.version == EIO3 && c.startAdmission() {
+		//the root namespace is joined without asking
+		s.admit(c, func(err error) {
+			s.connect(c, err)
+		})
+	}
+
+	s.tr.Serve(w, r)
+}
+
+// Channel - of the client with the given ID, nil when not connected
+func (s *Server) Channel(id string) *Channel {
+	s.channelsLock.RLock()
+	defer s.channelsLock.RUnlock()
+
+	return s.channels[id]
+}
+
+// Disconnect - close the connection of the client, its disconnect
+// handlers get ReasonServerDisconnect
+func (s *Server) Disconnect(c *Channel) {
+	if err := send(&protocol.Message{Type: protocol.MessageTypeDisconnect}, c, nil); err != nil {
+		closeChannel(c, &s.event, ReasonServerDisconnect, nil)
+		return
+	}
+	closeAfterWrite(c, &s.event, ReasonServerDisconnect, nil)
+}
+
+// SetAdapter - Replace the adapter keeping the rooms (a MemoryAdapter by
+// default), before serving any client
+func (s *Server) SetAdapter(a Adapter) error {
+	if err := a.Init(&node{server: s}); err != nil {
+		return err
+	}
+	s.adapter = a
+	return nil
+}
+
+// ServerSideEmit - Send a message to the other nodes linked by the adapter
+func (s *Server) ServerSideEmit(method string, args ...interface{}) error {
+	return s.adapter.ServerSideEmit(method, args)
+}
+
+// OnServerSideEmit - f is called for every ServerSideEmit of another node,
+// args is the JSON array of the arguments
+func (s *Server) OnServerSideEmit(f func(event string, args json.RawMessage)) {
+	s.serverSideLock.Lock()
+	s.serverSide = append(s.serverSide, f)
+	s.serverSideLock.Unlock()
+}
+
+// Close - disconnect every client and leave the other nodes
+func (s *Server) Close() {
+	s.channelsLock.RLock()
+	channels := make([]*Channel, 0, len(s.channels))
+	for _, c := range s.channels {
+		channels = append(channels, c)
+	}
+	s.channelsLock.RUnlock()
+
+	for _, c := range channels {
+		s.Disconnect(c)
+	}
+	if err := s.adapter.Close(); err != nil {
+		glog.Errorf("Failed to close adapter: %s", err)
+	}
+}
+
+// Request - HTTP request that opened the connection, nil for client channels
+func (c *Channel) Request() *http.Request {
+	return c.request
+}
+
+// Auth - auth payload of the CONNECT packet of an EIO4 client, nil otherwise
+func (c *Channel) Auth() json.RawMessage {
+	if c.server == nil {
+		return nil
+	}
+	auth, _ := c.auth.(json.RawMessage)
+	return auth
+}
+
+/**
+Error convention of the ack requests and responses
+*/
+func (s *Server) ackErrorSettings() AckErrorFormat {
+	return s.AckErrors
+}
+
+func (s *Server) add(c *Channel) {
+	s.channelsLock.Lock()
+	s.channels[c.header.Sid] = c
+	s.channelsLock.Unlock()
+}
+
+/**
+Forget a closed client, it leaves its rooms once its disconnect handlers ran
+*/
+func (s *Server) remove(c *Channel) {
+	s.adapter.DelAll(c.header.Sid)
+
+	s.channelsLock.Lock()
+	delete(s.channels, c.header.Sid)
+	s.channelsLock.Unlock()
+}
+
+/**
+A client asks to join a namespace, only the root one is served. With EIO4
+the root namespace is joined this way, the reply holds the socket id
+*/
+func (s *Server) accept(c *Channel, msg *protocol.Message) {
+	if msg.Namespace != "" {
+		refuse := &protocol.Message{Type: protocol.MessageTypeConnectError}
+		namespace := &Channel{session: c.session, namespace: msg.Namespace}
+		send(refuse, namespace, connectErrorPayload(c.version, &ConnectError{Message: "Invalid namespace"}))
+		return
+	}
+	if c.version != EIO4 || !c.startAdmission() {
+		return
+	}
+
+	if msg.Args != "" {
+		c.auth = json.RawMessage(msg.Args)
+	}
+	s.admit(c, func(err error) {
+		s.connect(c, err)
+	})
+}
+
+/**
+Connect an admitted client to the root namespace, or refuse it
+*/
+func (s *Server) connect(c *Channel, err error) {
+	if err != nil {
+		s.reject(c, err)
+		return
+	}
+
+	var reply interface{}
+	if c.version == EIO4 {
+		//a single namespace, the socket id is the session id
+		c.sid = c.header.Sid
+		reply = &connectReply{Sid: c.sid}
+	}
+	//the client may have gone while the middlewares ran, it has left its rooms
+	//already. Otherwise it may send events as soon as it gets the reply
+	c.aliveLock.Lock()
+	if !c.alive {
+		c.aliveLock.Unlock()
+		glog.V(2).Infof("Client %s gone before being admitted", c.header.Sid)
+		return
+	}
+	c.opened = true
+	c.aliveLock.Unlock()
+	c.Join(c.header.Sid)
+	if err := send(&protocol.Message{Type: protocol.MessageTypeConnect}, c, reply); err != nil {
+		glog.Errorf("Failed to send connect: %s", err)
+		closeChannel(c, &s.event, ReasonTransportError, err)
+		return
+	}
+	s.callLoopEvent(c, OnConnection)
+}
+
+/**
+Whether the client may go through the middlewares, only once per session
+*/
+func (c *Channel) startAdmission() bool {
+	c.aliveLock.Lock()
+	defer c.aliveLock.Unlock()
+
+	if !c.alive || c.admitting {
+		return false
+	}
+	c.admitting = true
+	return true
+}
+
+/**
+Random session id
+*/
+func newID() string {
+	id := make([]byte, 15)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(id)
+}
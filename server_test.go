@@ -0,0 +1,78 @@
+package gosio
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestServerDropsEventsBeforeConnect(t *testing.T) {
+	s, hs, endpoint := testServer(t)
+	defer hs.Close()
+	defer s.Close()
+
+	called := make(chan string, 4)
+	s.On("secret", func(c *Channel, arg string) string {
+		called <- arg
+		return "leaked"
+	})
+
+	ws := dialRaw(t, endpoint, "EIO=4")
+	defer ws.Close()
+
+	//neither events nor acks before the namespace CONNECT
+	writePacket(ws, `42["secret","event"]`)
+	writePacket(ws, `421["secret","ack"]`)
+	writePacket(ws, `451-["secret",{"_placeholder":true,"num":0}]`)
+	writePacket(ws, "b\x01")
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case arg := <-called:
+		t.Fatalf("handler called with %q before connect", arg)
+	default:
+	}
+
+	//an ack sent before connecting would come before the reply
+	writePacket(ws, "40")
+	if p := readSkippingPings(ws, time.Second); len(p) < 2 || p[:2] != "40" {
+		t.Fatalf("connect reply %q", p)
+	}
+	writePacket(ws, `421["secret","connected"]`)
+	if p := readSkippingPings(ws, time.Second); p != `431["leaked"]` {
+		t.Fatalf("ack %q", p)
+	}
+	if arg := <-called; arg != "connected" {
+		t.Fatalf("handler called with %q", arg)
+	}
+}
+
+func TestServerSurvivesMalformedPackets(t *testing.T) {
+	s, hs, endpoint := testServer(t)
+	defer hs.Close()
+	defer s.Close()
+	s.On("echo", func(c *Channel, arg string) string { return arg })
+
+	good := dialRaw(t, endpoint, "EIO=4")
+	defer good.Close()
+	writePacket(good, "40")
+	if p := readSkippingPings(good, time.Second); len(p) < 2 || p[:2] != "40" {
+		t.Fatalf("connect reply %q", p)
+	}
+
+	for i, packet := range []string{`431[`, `43/a,1[`, `461-1[`, `431`, `42["echo"`} {
+		bad := dialRaw(t, endpoint, "EIO=4")
+		writePacket(bad, "40")
+		readSkippingPings(bad, time.Second)
+		writePacket(bad, packet)
+		//the malformed packet closes the session of its client only
+		if p := readSkippingPings(bad, time.Second); p != "" {
+			t.Errorf("%q answered with %q", packet, p)
+		}
+		bad.Close()
+
+		writePacket(good, fmt.Sprintf(`42%d["echo","%d"]`, i, i))
+		if p := readSkippingPings(good, time.Second); p != fmt.Sprintf(`43%d["%d"]`, i, i) {
+			t.Fatalf("after %q: ack %q", packet, p)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package gosio
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/gnabgib/go-sio/protocol"
+	"github.com/golang/glog"
+)
+
+var (
+	errorRootNamespace = errors.New("The root namespace is handled by the client")
+)
+
+// Socket - a namespace multiplexed over the client connection
+// - use On, OnConnect and OnDisconnect to register namespace handlers
+// - handlers receive the Channel of the namespace, Emit and Ack on it stay in the namespace
+// - the namespace is joined again every time the client connects
+type Socket struct {
+	event
+	binding
+	client *Client
+
+	joined     *session
+	joinedLock sync.Mutex
+}
+
+// Socket - Handle for the given namespace (e.g. "/admin"), sharing the client connection
+// - the root namespace is handled by the client itself, asking for it is an error
+func (c *Client) Socket(namespace string) (*Socket, error) {
+	if !strings.HasPrefix(namespace, "/") {
+		namespace = "/" + namespace
+	}
+	if namespace == "/" {
+		return nil, errorRootNamespace
+	}
+
+	c.socketsLock.Lock()
+	s, ok := c.sockets[namespace]
+	if !ok {
+		s = &Socket{client: c}
+		s.initMethods()
+		s.namespace = namespace
+		s.settings = c.offlineSettings
+		s.ackErrors = c.ackErrorSettings
+		c.sockets[namespace] = s
+	}
+	c.socketsLock.Unlock()
+
+	if root := c.current(); root != nil {
+		s.bindSession(root.session)
+		if root.isOpened() {
+			s.join(root)
+		}
+	}
+	return s, nil
+}
+
+// Close - leave the namespace, the client connection stays open
+func (s *Socket) Close() {
+	s.client.socketsLock.Lock()
+	delete(s.client.sockets, s.namespace)
+	s.client.socketsLock.Unlock()
+
+	c := s.current()
+	if c == nil {
+		return
+	}
+	if c.IsAlive() {
+		send(&protocol.Message{Type: protocol.MessageTypeDisconnect}, c, nil)
+	}
+	s.leave(c.session, ReasonClientDisconnect)
+}
+
+/**
+Channel of the namespace over the given session, bound on first use
+*/
+func (s *Socket) bindSession(sess *session) *Channel {
+	s.channelLock.Lock()
+	defer s.channelLock.Unlock()
+
+	if s.channel == nil || s.channel.session != sess {
+		s.channel = &Channel{session: sess, namespace: s.namespace, owner: &s.binding, events: &s.event}
+	}
+	return s.channel
+}
+
+/**
+Send the namespace CONNECT over the session of the root channel,
+only once per session
+*/
+func (s *Socket) join(root *Channel) {
+	s.joinedLock.Lock()
+	defer s.joinedLock.Unlock()
+
+	if s.joined == root.session {
+		return
+	}
+	s.joined = root.session
+	c := s.bindSession(root.session)
+
+	var auth interface{}
+	if root.version == EIO4 {
+		auth = root.auth
+	}
+	connect := &protocol.Message{Type: protocol.MessageTypeConnect}
+	if err := send(connect, c, auth); err != nil {
+		glog.Errorf("Failed to join namespace %s: %s", s.namespace, err)
+	}
+}
+
+/**
+Server confirmed the namespace CONNECT sent over the given session
+*/
+func (s *Socket) connected(sess *session, msg *protocol.Message) {
+	c := s.channelOf(sess)
+	if c == nil {
+		return
+	}
+	if msg.Args != "" {
+		var reply connectReply
+		if err := json.Unmarshal([]byte(msg.Args), &reply); err != nil {
+			glog.Errorf("Failed to decode connect reply of %s: %s", s.namespace, err)
+			s.callError(c, &DecodeError{Source: msg.Source, Err: err})
+		}
+		c.sid = reply.Sid
+	}
+	flushOffline(c)
+	s.callLoopEvent(c, OnConnection)
+}
+
+/**
+Namespace is no longer joined over the given session, calls OnDisconnection
+if it was
+*/
+func (s *Socket) leave(sess *session, reason DisconnectReason) {
+	s.joinedLock.Lock()
+	if s.joined != sess {
+		s.joinedLock.Unlock()
+		return
+	}
+	s.joined = nil
+	s.joinedLock.Unlock()
+
+	c := s.channelOf(sess)
+	if c == nil {
+		c = &Channel{session: sess, namespace: s.namespace, owner: &s.binding, events: &s.event}
+	}
+	c.aliveLock.Lock()
+	c.left = reason
+	c.aliveLock.Unlock()
+	//emits are buffered until the namespace is joined again
+	s.unready(sess)
+
+	s.callLoopEvent(c, OnDisconnection)
+}
+
+/**
+Registered namespace socket, nil when the namespace is unknown
+*/
+func (e *event) socket(namespace string) *Socket {
+	e.socketsLock.Lock()
+	defer e.socketsLock.Unlock()
+
+	return e.sockets[namespace]
+}
+
+/**
+Channel and handlers a message is addressed to, the root namespace
+is handled by e itself
+*/
+func (e *event) route(c *Channel, namespace string) (*Channel, *event, bool) {
+	if namespace == "" {
+		return c, e, true
+	}
+
+	s := e.socket(namespace)
+	if s == nil {
+		return nil, nil, false
+	}
+	ch := s.channelOf(c.session)
+	if ch == nil {
+		return nil, nil, false
+	}
+	return ch, &s.event, true
+}
+
+/**
+Bind every namespace to the session of a new root channel
+*/
+func (e *event) bindSockets(c *Channel) {
+	for _, s := range e.allSockets() {
+		s.bindSession(c.session)
+	}
+}
+
+/**
+Join every namespace over the freshly opened session
+*/
+func (e *event) joinSockets(c *Channel) {
+	for _, s := range e.allSockets() {
+		s.join(c)
+	}
+}
+
+/**
+The session is gone, every namespace joined over it is disconnected
+*/
+func (e *event) leaveSockets(c *Channel, reason DisconnectReason) {
+	for _, s := range e.allSockets() {
+		s.leave(c.session, reason)
+	}
+}
+
+func (e *event) allSockets() []*Socket {
+	e.socketsLock.Lock()
+	defer e.socketsLock.Unlock()
+
+	sockets := make([]*Socket, 0, len(e.sockets))
+	for _, s := range e.sockets {
+		sockets = append(sockets, s)
+	}
+	return sockets
+}
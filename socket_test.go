@@ -0,0 +1,74 @@
+package gosio
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gnabgib/go-sio/transport"
+	"github.com/gorilla/websocket"
+)
+
+func TestSocketRootNamespace(t *testing.T) {
+	c := New(nil, transport.GetDefaultWebsocketTransport())
+	for _, namespace := range []string{"/", ""} {
+		if s, err := c.Socket(namespace); err != errorRootNamespace || s != nil {
+			t.Errorf("Socket(%q) = %v, %v", namespace, s, err)
+		}
+	}
+}
+
+func TestSocketLeftByServer(t *testing.T) {
+	got := make(chan string, 10)
+	srv, u := fakeServer(t, func(ws *websocket.Conn, r *http.Request) {
+		writePacket(ws, `0{"sid":"eng","upgrades":[],"pingInterval":20000,"pingTimeout":2000}`)
+		got <- readPacket(ws, time.Second)
+		got <- readPacket(ws, time.Second)
+		writePacket(ws, `40{"sid":"root"}`)
+		writePacket(ws, `40/admin,{"sid":"adm"}`)
+		got <- readPacket(ws, time.Second)
+		writePacket(ws, `41/admin,`)
+		got <- readPacket(ws, time.Second)
+	})
+	defer srv.Close()
+
+	c := New(u, transport.GetDefaultWebsocketTransport())
+	c.Version = EIO4
+	admin, err := c.Socket("/admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	left := make(chan bool, 1)
+	admin.OnConnect(func(ch *Channel) { admin.Emit("first") })
+	admin.OnDisconnect(func(ch *Channel) { left <- true })
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if p := <-got; p != "40" {
+		t.Fatal(p)
+	}
+	if p := <-got; p != "40/admin," {
+		t.Fatal(p)
+	}
+	if p := <-got; p != `42/admin,["first"]` {
+		t.Fatal(p)
+	}
+	select {
+	case <-left:
+	case <-time.After(time.Second):
+		t.Fatal("namespace not left")
+	}
+
+	//buffered until the namespace is joined again, the root one is still connected
+	if err := admin.Emit("late"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Emit("root"); err != nil {
+		t.Fatal(err)
+	}
+	if p := <-got; p != `42["root"]` {
+		t.Fatalf("got %q", p)
+	}
+}
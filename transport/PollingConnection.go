@@ -0,0 +1,318 @@
+package transport
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gnabgib/go-sio/protocol"
+)
+
+const (
+	openPacket  = "0"
+	closePacket = "1"
+	//EIO3 prefix of base64 encoded binary messages
+	base64Message = "b4"
+	//EIO4 separator of the packets of a payload
+	recordSeparator = "\x1e"
+)
+
+var (
+	errClosed       = errors.New("Connection closed")
+	errWrongPayload = errors.New("Wrong payload")
+)
+
+// PollingConnection - A HTTP long-polling connection
+// - GetMessage issues GET requests, WriteMessage POST requests
+// - binary messages are base64 encoded in the payload
+type PollingConnection struct {
+	transport *PollingTransport
+	client    *http.Client
+	url       *url.URL
+	eio3      bool
+	//sent with every request and the upgrade
+	header http.Header
+
+	queue []string
+
+	//held while a poll is in flight
+	pollLock sync.Mutex
+	paused   bool
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+}
+
+func (pc *PollingConnection) String() string {
+	return pc.url.Host
+}
+
+// GetMessage - Receive a message (blocking), polls the server when nothing is buffered
+// - once paused by an upgrade, blocks until the connection is discarded
+func (pc *PollingConnection) GetMessage() (message string, err error) {
+	for len(pc.queue) == 0 {
+		pc.pollLock.Lock()
+		if pc.paused {
+			pc.pollLock.Unlock()
+			<-pc.ctx.Done()
+			return "", errClosed
+		}
+		err := pc.poll(pc.ctx)
+		pc.pollLock.Unlock()
+
+		if err != nil {
+			return "", err
+		}
+	}
+
+	message, pc.queue = pc.queue[0], pc.queue[1:]
+	return message, nil
+}
+
+// WriteMessage - Send a message (blocking)
+func (pc *PollingConnection) WriteMessage(message string) error {
+	select {
+	case <-pc.ctx.Done():
+		return errClosed
+	default:
+	}
+	return pc.post(pc.ctx, message)
+}
+
+// Close connection, the server is told the session is over
+func (pc *PollingConnection) Close() {
+	pc.closeOnce.Do(func() {
+		pc.cancel()
+		//best effort, the server drops the session on ping timeout anyway
+		go pc.post(context.Background(), closePacket)
+	})
+}
+
+// PingParams - time interval and timeout settings for ping
+func (pc *PollingConnection) PingParams() (interval, timeout time.Duration) {
+	return pc.transport.PingInterval, pc.transport.PingTimeout
+}
+
+// Probe - open a websocket for the same session and check it with a probe,
+// polling is paused (the poll in flight completes) once the probe succeeds
+func (pc *PollingConnection) Probe(upgrades []string) (conn Connection, err error) {
+	wst := pc.transport.Upgrade
+	if wst == nil || !hasUpgrade(upgrades, websocketUpgrade) {
+		return nil, errNoUpgrade
+	}
+
+	ws, err := wst.dial(pc.ctx, websocketURL(pc.url), pc.header, pc.client.Jar)
+	if err != nil {
+		return nil, err
+	}
+	if err := ws.WriteMessage(protocol.ProbeMessage); err != nil {
+		ws.Close()
+		return nil, err
+	}
+	reply, err := ws.GetMessage()
+	if err != nil || reply != protocol.ProbeReplyMessage {
+		ws.Close()
+		return nil, errProbeFailed
+	}
+
+	pc.pollLock.Lock()
+	pc.paused = true
+	pc.pollLock.Unlock()
+
+	return ws, nil
+}
+
+// Discard - stop the connection without closing the session
+func (pc *PollingConnection) Discard() {
+	pc.closeOnce.Do(pc.cancel)
+}
+
+// GET the next payload and append its messages to the queue
+func (pc *PollingConnection) poll(parent context.Context) error {
+	ctx, cancel := context.WithTimeout(parent, pc.transport.ReceiveTimeout)
+	defer cancel()
+
+	req, err := pc.request(ctx, http.MethodGet, "")
+	if err != nil {
+		return err
+	}
+	data, err := pc.do(req)
+	if err != nil {
+		return err
+	}
+
+	messages, err := pc.decodePayload(data)
+	if err != nil {
+		return err
+	}
+	pc.queue = append(pc.queue, messages...)
+	return nil
+}
+
+// POST a single message payload
+func (pc *PollingConnection) post(parent context.Context, message string) error {
+	ctx, cancel := context.WithTimeout(parent, pc.transport.SendTimeout)
+	defer cancel()
+
+	req, err := pc.request(ctx, http.MethodPost, pc.encodePayload(message))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain;charset=UTF-8")
+	_, err = pc.do(req)
+	return err
+}
+
+func (pc *PollingConnection) request(ctx context.Context, method, body string) (*http.Request, error) {
+	u := *pc.url
+	q := u.Query()
+	//defeat caches between client and server
+	q.Set("t", strconv.FormatInt(time.Now().UnixNano(), 36))
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(method, u.String(), strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range pc.header {
+		req.Header[k] = v
+	}
+	return req.WithContext(ctx), nil
+}
+
+func (pc *PollingConnection) do(req *http.Request) (string, error) {
+	resp, err := pc.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", errBadBuffer
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Polling %s failed: %s %s", req.Method, resp.Status, data)
+	}
+	return string(data), nil
+}
+
+// Split a payload into messages, EIO3 prefixes every packet with its length
+// (in UTF-16 units), EIO4 separates them with a record separator
+func (pc *PollingConnection) decodePayload(payload string) ([]string, error) {
+	var packets []string
+	if pc.eio3 {
+		for len(payload) > 0 {
+			pos := strings.IndexByte(payload, ':')
+			if pos == -1 {
+				return nil, errWrongPayload
+			}
+			length, err := strconv.Atoi(payload[:pos])
+			if err != nil || length < 1 {
+				//an empty packet would never consume the payload
+				return nil, errWrongPayload
+			}
+			payload = payload[pos+1:]
+
+			end := utf16Offset(payload, length)
+			if end == -1 {
+				return nil, errWrongPayload
+			}
+			packets = append(packets, payload[:end])
+			payload = payload[end:]
+		}
+	} else if len(payload) > 0 {
+		packets = strings.Split(payload, recordSeparator)
+	}
+
+	messages := make([]string, 0, len(packets))
+	for _, packet := range packets {
+		message, err := pc.decodePacket(packet)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+// Binary packets are base64 encoded in the payload, the connection
+// hands them over as raw bytes
+func (pc *PollingConnection) decodePacket(packet string) (string, error) {
+	prefix := protocol.BinaryMessage
+	if pc.eio3 {
+		prefix = base64Message
+	}
+	if !strings.HasPrefix(packet, prefix) {
+		return packet, nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(packet[len(prefix):])
+	if err != nil {
+		return "", err
+	}
+	return protocol.BinaryMessage + string(data), nil
+}
+
+func (pc *PollingConnection) encodePayload(message string) string {
+	if strings.HasPrefix(message, protocol.BinaryMessage) {
+		data := base64.StdEncoding.EncodeToString([]byte(message[len(protocol.BinaryMessage):]))
+		message = protocol.BinaryMessage + data
+		if pc.eio3 {
+			message = base64Message + data
+		}
+	}
+
+	if pc.eio3 {
+		return strconv.Itoa(utf16Length(message)) + ":" + message
+	}
+	return message
+}
+
+func hasUpgrade(upgrades []string, name string) bool {
+	for _, upgrade := range upgrades {
+		if upgrade == name {
+			return true
+		}
+	}
+	return false
+}
+
+// length of s as counted by javascript
+func utf16Length(s string) int {
+	length := 0
+	for _, r := range s {
+		length++
+		if r > 0xFFFF {
+			length++
+		}
+	}
+	return length
+}
+
+// byte offset in s after the given number of UTF-16 units, -1 when s is too short
+func utf16Offset(s string, units int) int {
+	offset := 0
+	for units > 0 {
+		if offset >= len(s) {
+			return -1
+		}
+		r, size := utf8.DecodeRuneInString(s[offset:])
+		offset += size
+		units--
+		if r > 0xFFFF {
+			units--
+		}
+	}
+	return offset
+}
@@ -0,0 +1,112 @@
+package transport
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodePayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		eio3    bool
+		payload string
+		want    []string
+	}{
+		{"eio3 single", true, `7:42["a"]`, []string{`42["a"]`}},
+		{"eio3 several", true, `7:42["a"]2:401:2`, []string{`42["a"]`, "40", "2"}},
+		{"eio3 non-BMP", true, `8:42["😀"]9:42["é😀"]`, []string{`42["😀"]`, `42["é😀"]`}},
+		{"eio3 binary", true, `6:b4AQID2:40`, []string{"b\x01\x02\x03", "40"}},
+		{"eio3 empty", true, "", nil},
+		{"eio4 single", false, `42["a"]`, []string{`42["a"]`}},
+		{"eio4 several", false, "42[\"😀\"]\x1e40\x1e2", []string{`42["😀"]`, "40", "2"}},
+		{"eio4 binary", false, "bAQID\x1e40", []string{"b\x01\x02\x03", "40"}},
+		{"eio4 empty", false, "", nil},
+	}
+	for _, test := range tests {
+		pc := &PollingConnection{eio3: test.eio3}
+		got, err := pc.decodePayload(test.payload)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if len(got) == 0 && len(test.want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDecodePayloadErrors(t *testing.T) {
+	for _, payload := range []string{
+		`42["a"]`,
+		`x:42`,
+		`8:42["a"]`,
+		`0:42`,
+		`-1:42`,
+		`9:42["😀"]`,
+		`6:b4!!!!`,
+	} {
+		pc := &PollingConnection{eio3: true}
+		if got, err := pc.decodePayload(payload); err == nil {
+			t.Errorf("eio3 %q: got %q, want an error", payload, got)
+		}
+	}
+
+	pc := &PollingConnection{}
+	if got, err := pc.decodePayload("b!!!!"); err == nil {
+		t.Errorf("eio4: got %q, want an error", got)
+	}
+}
+
+func TestEncodePayload(t *testing.T) {
+	tests := []struct {
+		eio3    bool
+		message string
+		want    string
+	}{
+		{true, `42["a"]`, `7:42["a"]`},
+		{true, `42["😀"]`, `8:42["😀"]`},
+		{true, "b\x01\x02\x03", "6:b4AQID"},
+		{false, `42["😀"]`, `42["😀"]`},
+		{false, "b\x01\x02\x03", "bAQID"},
+	}
+	for _, test := range tests {
+		pc := &PollingConnection{eio3: test.eio3}
+		got := pc.encodePayload(test.message)
+		if got != test.want {
+			t.Errorf("encodePayload(%q) eio3=%v = %q, want %q", test.message, test.eio3, got, test.want)
+			continue
+		}
+
+		//what is encoded decodes back
+		decoded, err := pc.decodePayload(got)
+		if err != nil || len(decoded) != 1 || decoded[0] != test.message {
+			t.Errorf("decodePayload(%q) = %q, %v", got, decoded, err)
+		}
+	}
+}
+
+func TestUTF16(t *testing.T) {
+	for _, test := range []struct {
+		s      string
+		length int
+	}{
+		{"", 0},
+		{"abc", 3},
+		{"é", 1},
+		{"😀", 2},
+		{"a😀b", 4},
+	} {
+		if got := utf16Length(test.s); got != test.length {
+			t.Errorf("utf16Length(%q) = %d, want %d", test.s, got, test.length)
+		}
+		if got := utf16Offset(test.s+"!", test.length); got != len(test.s) {
+			t.Errorf("utf16Offset(%q, %d) = %d, want %d", test.s+"!", test.length, got, len(test.s))
+		}
+	}
+	if got := utf16Offset("ab", 3); got != -1 {
+		t.Errorf("utf16Offset past the end = %d, want -1", got)
+	}
+}
@@ -0,0 +1,147 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	websocketUpgrade = "websocket"
+)
+
+var (
+	errNoOpenPacket  = errors.New("Handshake did not start with an open packet")
+	errPollingServer = errors.New("Polling is not supported server side")
+	errNoUpgrade     = errors.New("No upgrade available")
+	errProbeFailed   = errors.New("Upgrade probe failed")
+)
+
+// PollingTransport - Connection factory for HTTP long-polling
+// - URLs built for websocket (ws/wss, transport=websocket) are converted
+// - cookies set by the server (e.g. sticky sessions) are kept per connection
+// - when Upgrade is set, connections can be upgraded to websocket
+type PollingTransport struct {
+	PingInterval   time.Duration
+	PingTimeout    time.Duration
+	ReceiveTimeout time.Duration
+	SendTimeout    time.Duration
+
+	RequestHeader http.Header
+	// Jar - cookie jar shared by all connections, a new one per connection when nil
+	Jar http.CookieJar
+
+	// Upgrade - websocket transport to upgrade to, nil to stay on polling
+	Upgrade *WebsocketTransport
+}
+
+// Connect - Establish a new connection, the handshake is done with the first poll
+func (pt *PollingTransport) Connect(u *url.URL) (conn Connection, err error) {
+	return pt.ConnectContext(context.Background(), u)
+}
+
+// ConnectContext - Establish a new connection, the handshake is aborted when ctx is done
+func (pt *PollingTransport) ConnectContext(ctx context.Context, u *url.URL) (conn Connection, err error) {
+	jar := pt.Jar
+	if jar == nil {
+		if jar, err = cookiejar.New(nil); err != nil {
+			return nil, err
+		}
+	}
+
+	pc := &PollingConnection{
+		transport: pt,
+		client:    &http.Client{Jar: jar},
+		url:       pollingURL(u),
+		eio3:      isEIO3(u.Query()),
+		header:    requestHeader(ctx, pt.RequestHeader),
+	}
+	pc.ctx, pc.cancel = context.WithCancel(context.Background())
+
+	if err := pc.poll(ctx); err != nil {
+		pc.cancel()
+		return nil, err
+	}
+	if len(pc.queue) == 0 || !strings.HasPrefix(pc.queue[0], openPacket) {
+		pc.cancel()
+		return nil, errNoOpenPacket
+	}
+
+	var header struct {
+		Sid string `json:"sid"`
+	}
+	if err := json.Unmarshal([]byte(pc.queue[0][len(openPacket):]), &header); err != nil {
+		pc.cancel()
+		return nil, err
+	}
+	q := pc.url.Query()
+	q.Set("sid", header.Sid)
+	pc.url.RawQuery = q.Encode()
+
+	return pc, nil
+}
+
+// HandleConnection - not supported, polling is client side only
+func (pt *PollingTransport) HandleConnection(
+	w http.ResponseWriter, r *http.Request) (conn Connection, err error) {
+
+	http.Error(w, errPollingServer.Error(), http.StatusNotImplemented)
+	return nil, errPollingServer
+}
+
+// Serve - noop (server side is not supported)
+func (pt *PollingTransport) Serve(w http.ResponseWriter, r *http.Request) {}
+
+// GetDefaultPollingTransport - Returns polling connection with default interval/timeout settings
+func GetDefaultPollingTransport() *PollingTransport {
+	return &PollingTransport{
+		PingInterval:   defaultPingInterval,
+		PingTimeout:    defaultPingTimeout,
+		ReceiveTimeout: defaultReceiveTimeout,
+		SendTimeout:    defaultSendTimeout,
+		Upgrade:        GetDefaultWebsocketTransport(),
+	}
+}
+
+// copy of the URL pointing to the polling endpoint
+func pollingURL(u *url.URL) *url.URL {
+	result := *u
+	switch result.Scheme {
+	case "ws":
+		result.Scheme = "http"
+	case "wss":
+		result.Scheme = "https"
+	}
+
+	q := result.Query()
+	q.Set("transport", "polling")
+	if isEIO3(q) {
+		//ask for base64 encoded binary instead of binary payloads
+		q.Set("b64", "1")
+	}
+	result.RawQuery = q.Encode()
+	return &result
+}
+
+// copy of a polling URL pointing to the websocket endpoint
+func websocketURL(u *url.URL) *url.URL {
+	result := *u
+	switch result.Scheme {
+	case "http":
+		result.Scheme = "ws"
+	case "https":
+		result.Scheme = "wss"
+	}
+
+	q := result.Query()
+	q.Set("transport", websocketUpgrade)
+	q.Del("b64")
+	q.Del("t")
+	result.RawQuery = q.Encode()
+	return &result
+}
@@ -3,22 +3,32 @@ package transport
 import (
 	"errors"
 	"io/ioutil"
+	"strings"
 	"time"
 
+	"github.com/gnabgib/go-sio/protocol"
 	"github.com/gorilla/websocket"
 )
 
+const (
+	//EIO3 binary frames start with the message packet type
+	binaryPacketType = 4
+)
+
 var (
-	errBinaryMessage = errors.New("Binary messages are not currently supported")
+	errBinaryMessage = errors.New("Unknown binary message")
 	errBadBuffer     = errors.New("Buffer error")
 	errEmptyMessage  = errors.New("Empty message received")
 )
 
 // WebsocketConnection - A websocket connection
+// - binary frames are exchanged as messages starting with protocol.BinaryMessage
 type WebsocketConnection struct {
 	socket    *websocket.Conn
 	transport *WebsocketTransport
 	url string
+
+	typedBinary bool
 }
 
 func (ws *WebsocketConnection) String() string {
@@ -33,15 +43,20 @@ func (ws *WebsocketConnection) GetMessage() (message string, err error) {
 		return "", err
 	}
 
-	//support only text messages exchange
-	if msgType != websocket.TextMessage {
-		return "", errBinaryMessage
-	}
-
 	data, err := ioutil.ReadAll(reader)
 	if err != nil {
 		return "", errBadBuffer
 	}
+
+	if msgType == websocket.BinaryMessage {
+		if ws.typedBinary {
+			if len(data) == 0 || data[0] != binaryPacketType {
+				return "", errBinaryMessage
+			}
+			data = data[1:]
+		}
+		return protocol.BinaryMessage + string(data), nil
+	}
 	text := string(data)
 
 	//empty messages are not allowed
@@ -55,12 +70,20 @@ func (ws *WebsocketConnection) GetMessage() (message string, err error) {
 // WriteMessage - Send a message (blocking)
 func (ws *WebsocketConnection) WriteMessage(message string) error {
 	ws.socket.SetWriteDeadline(time.Now().Add(ws.transport.SendTimeout))
-	writer, err := ws.socket.NextWriter(websocket.TextMessage)
+	msgType, data := websocket.TextMessage, []byte(message)
+	if strings.HasPrefix(message, protocol.BinaryMessage) {
+		msgType, data = websocket.BinaryMessage, data[len(protocol.BinaryMessage):]
+		if ws.typedBinary {
+			data = append([]byte{binaryPacketType}, data...)
+		}
+	}
+
+	writer, err := ws.socket.NextWriter(msgType)
 	if err != nil {
 		return err
 	}
 
-	if _, err := writer.Write([]byte(message)); err != nil {
+	if _, err := writer.Write(data); err != nil {
 		return err
 	}
 	if err := writer.Close(); err != nil {
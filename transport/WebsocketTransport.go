@@ -1,6 +1,7 @@
 package transport
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"net/url"
@@ -37,13 +38,30 @@ type WebsocketTransport struct {
 
 // Connect - Establish a new connection
 func (wst *WebsocketTransport) Connect(url *url.URL) (conn Connection, err error) {
-	dialer := websocket.DefaultDialer
-	socket, _, err := dialer.Dial(url.String(), wst.RequestHeader)
+	return wst.ConnectContext(context.Background(), url)
+}
+
+// ConnectContext - Establish a new connection, the dial is aborted when ctx is done
+func (wst *WebsocketTransport) ConnectContext(ctx context.Context, url *url.URL) (conn Connection, err error) {
+	ws, err := wst.dial(ctx, url, requestHeader(ctx, wst.RequestHeader), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return ws, nil
+}
+
+//dial with the given headers and cookies (used when upgrading from polling)
+func (wst *WebsocketTransport) dial(ctx context.Context, url *url.URL, header http.Header,
+	jar http.CookieJar) (*WebsocketConnection, error) {
+	dialer := *websocket.DefaultDialer
+	dialer.Jar = jar
+	socket, _, err := dialer.DialContext(ctx, url.String(), header)
 	if err != nil {
 		return nil, err
 	}
 
-	return &WebsocketConnection{socket, wst, url.Host}, nil
+	return &WebsocketConnection{socket, wst, url.Host, isEIO3(url.Query())}, nil
 }
 
 // HandleConnection -
@@ -61,7 +79,7 @@ func (wst *WebsocketTransport) HandleConnection(
 		return nil, errHTTPUpgradeFailed
 	}
 
-	return &WebsocketConnection{socket, wst, ""}, nil
+	return &WebsocketConnection{socket, wst, "", isEIO3(r.URL.Query())}, nil
 }
 
 // Serve - noop (no further processing required for WS)
@@ -1,11 +1,42 @@
 package transport
 
 import (
+	"context"
 	"net/http"
 	"net/url"
 	"time"
 )
 
+const (
+	eio4 = "4"
+)
+
+//context key of the headers added to a single connection
+type requestHeaderKey struct{}
+
+// WithRequestHeader - ctx carrying headers for the connection dialed with it
+// (ConnectContext), added to the RequestHeader of the transport
+func WithRequestHeader(ctx context.Context, header http.Header) context.Context {
+	return context.WithValue(ctx, requestHeaderKey{}, header)
+}
+
+//base with the headers carried by ctx, base itself when there are none
+func requestHeader(ctx context.Context, base http.Header) http.Header {
+	extra, _ := ctx.Value(requestHeaderKey{}).(http.Header)
+	if len(extra) == 0 {
+		return base
+	}
+
+	header := make(http.Header, len(base)+len(extra))
+	for k, v := range base {
+		header[k] = v
+	}
+	for k, v := range extra {
+		header[k] = v
+	}
+	return header
+}
+
 //Connection for given transport
 type Connection interface {
 	// GetMessage - Receive a message (blocking)
@@ -35,3 +66,24 @@ type Transport interface {
 	//Serve HTTP request after establishing a connection
 	Serve(w http.ResponseWriter, r *http.Request)
 }
+
+//ContextTransport - Transport whose connections can be cancelled while connecting
+type ContextTransport interface {
+	// ConnectContext - get client connection, gives up when ctx is done
+	ConnectContext(ctx context.Context, url *url.URL) (conn Connection, err error)
+}
+
+//Upgrader - Connection that can be replaced by a better transport once the session is open
+type Upgrader interface {
+	// Probe - connect and probe a replacement among the upgrades offered by the server,
+	// on success this connection is paused until discarded
+	Probe(upgrades []string) (conn Connection, err error)
+
+	// Discard - drop the connection once replaced, the session stays open
+	Discard()
+}
+
+//whether the query asks for Engine.IO v3 (the default when EIO is missing)
+func isEIO3(query url.Values) bool {
+	return query.Get("EIO") != eio4
+}
@@ -0,0 +1,46 @@
+package gosio
+
+import (
+	"github.com/gnabgib/go-sio/protocol"
+	"github.com/gnabgib/go-sio/transport"
+	"github.com/golang/glog"
+)
+
+/**
+Probe the upgrades offered in the handshake and swap the channel connection
+for the probed one, messages queued in the out channel are sent over the new
+connection. On failure the channel stays on the current connection
+*/
+func upgrade(c *Channel, e *event, current transport.Upgrader) {
+	next, err := current.Probe(c.header.Upgrades)
+	if err != nil {
+		glog.V(2).Infof("Staying on %s: %s", c.connection(), err)
+		return
+	}
+
+	//no message can be written while swapping, the in loop drains the
+	//current connection and switches once it is discarded
+	c.connLock.Lock()
+	err = next.WriteMessage(protocol.UpgradeMessage)
+	if err == nil {
+		c.conn = next
+	}
+	c.connLock.Unlock()
+
+	if err != nil {
+		glog.Errorf("Failed to upgrade: %s", err)
+		next.Close()
+		err = &TransportError{Op: "upgrade", Packet: protocol.UpgradeMessage, Err: err}
+		e.callError(c, err)
+		closeChannel(c, e, ReasonTransportError, err)
+		return
+	}
+	current.Discard()
+
+	if !c.IsAlive() {
+		//closed while upgrading
+		next.Close()
+		return
+	}
+	glog.V(4).Infoln("Upgraded channel to", next)
+}
@@ -0,0 +1,141 @@
+package gosio
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gnabgib/go-sio/transport"
+	"github.com/gorilla/websocket"
+)
+
+// upgradingServer serves an EIO4 session over polling and lets it upgrade to
+// websocket, the probe is answered once probe is closed. Events received are
+// sent to events prefixed with the transport, POSTs of events are answered
+// shortly after the probe
+type upgradingServer struct {
+	probing  chan bool
+	probe    chan struct{}
+	answered chan struct{}
+	events   chan string
+	replies  chan string
+}
+
+func (s *upgradingServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	switch {
+	case q.Get("transport") == "websocket":
+		ws, err := websocket.Upgrade(w, r, nil, 1024, 1024)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		if p := readPacket(ws, time.Second); p != "2probe" {
+			return
+		}
+		s.probing <- true
+		<-s.probe
+		writePacket(ws, "3probe")
+		//the client swaps the connection as soon as the POST in flight is done
+		time.Sleep(100 * time.Millisecond)
+		close(s.answered)
+		if p := readPacket(ws, time.Second); p != "5" {
+			return
+		}
+		for p := readPacket(ws, time.Second); p != ""; p = readPacket(ws, time.Second) {
+			if strings.HasPrefix(p, "42") {
+				s.events <- "websocket " + p
+			}
+		}
+	case q.Get("sid") == "":
+		fmt.Fprint(w, `0{"sid":"eng","upgrades":["websocket"],"pingInterval":20000,"pingTimeout":5000}`)
+	case r.Method == http.MethodPost:
+		body, _ := ioutil.ReadAll(r.Body)
+		for _, p := range strings.Split(string(body), "\x1e") {
+			switch {
+			case p == "40":
+				s.replies <- `40{"sid":"a"}`
+			case strings.HasPrefix(p, "42"):
+				<-s.answered
+				s.events <- "polling " + p
+			}
+		}
+		fmt.Fprint(w, "ok")
+	default:
+		select {
+		case p := <-s.replies:
+			fmt.Fprint(w, p)
+		case <-s.probe:
+			//the poll in flight ends once the probe is answered
+			fmt.Fprint(w, "6")
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+			fmt.Fprint(w, "6")
+		}
+	}
+}
+
+func TestUpgradeKeepsOrder(t *testing.T) {
+	s := &upgradingServer{
+		probing:  make(chan bool, 1),
+		probe:    make(chan struct{}),
+		answered: make(chan struct{}),
+		events:   make(chan string, 16),
+		replies:  make(chan string, 1),
+	}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	u, _ := url.Parse(strings.Replace(srv.URL, "http", "ws", 1) + "/socket.io/?transport=websocket")
+
+	c := New(u, transport.GetDefaultPollingTransport())
+	c.Version = EIO4
+	connected := make(chan bool, 1)
+	c.OnConnect(func(ch *Channel) { connected <- true })
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for _, ready := range []chan bool{connected, s.probing} {
+		select {
+		case <-ready:
+		case <-time.After(2 * time.Second):
+			t.Fatal("not connected and probing")
+		}
+	}
+	//the first emit holds the polling connection, the next ones are queued
+	for i := 0; i < 5; i++ {
+		c.Emit("queued", i)
+	}
+	close(s.probe)
+
+	for i := 0; i < 5; i++ {
+		want := fmt.Sprintf(`websocket 42["queued",%d]`, i)
+		if i == 0 {
+			want = `polling 42["queued",0]`
+		}
+		select {
+		case p := <-s.events:
+			if p != want {
+				t.Fatalf("received %q, want %q", p, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("queued emit %d lost", i)
+		}
+	}
+
+	c.Emit("upgraded")
+	select {
+	case p := <-s.events:
+		if p != `websocket 42["upgraded"]` {
+			t.Errorf("received %q after the upgrade", p)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("emit after the upgrade lost")
+	}
+}